@@ -0,0 +1,231 @@
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattmoor/cloudevents-go-fn/pkg/function"
+)
+
+// contractTestFile and contractHelpersFile are the names of the files that
+// hold the contract test and its helpers in the command package.
+const (
+	contractTestFile    = "ce_fn_contract_test.go"
+	contractHelpersFile = "ce_fn_contract_helpers_test.go"
+)
+
+// contractHelpers holds the source of the helpers of the contract test,
+// which are compiled into ce-fn as well, so that they are tested along with
+// it.
+//
+//go:embed contract_helpers.go
+var contractHelpers string
+
+// responseSuffix is the suffix of the files that hold the expected responses
+// to the sample events.
+const responseSuffix = ".response.json"
+
+// contractTest runs the function in the test binary, sends it the sample
+// events in $CE_FN_EVENTS through the scaffolding of the http protocol, and
+// compares the responses with those expected.
+const contractTest = `package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+const responseSuffix = ` + "`" + responseSuffix + "`" + `
+
+func TestContract(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(os.Getenv("CE_FN_EVENTS"), "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the function on a free port.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	os.Setenv("PORT", strconv.Itoa(port))
+	go main()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	if err := waitForReady(base + "/version"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		if strings.HasSuffix(f, responseSuffix) {
+			continue
+		}
+		f := f
+		t.Run(strings.TrimSuffix(filepath.Base(f), ".json"), func(t *testing.T) {
+			body, err := ioutil.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var event cloudevents.Event
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Fatalf("%s is not a CloudEvent in structured JSON: %v", f, err)
+			}
+
+			resp, err := http.Post(base+os.Getenv("CE_FN_PATH"), "application/cloudevents+json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				msg, _ := ioutil.ReadAll(resp.Body)
+				t.Fatalf("the function rejected the event: %s %s", resp.Status, bytes.TrimSpace(msg))
+			}
+
+			want, err := ioutil.ReadFile(strings.TrimSuffix(f, ".json") + responseSuffix)
+			if os.IsNotExist(err) {
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpResponse(resp))
+			if err != nil {
+				t.Fatalf("the function did not respond with an event: %v", err)
+			}
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff, err := diffEvents(want, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff != "" {
+				t.Errorf("response (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+`
+
+func testCmd(args []string) error {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	events := fs.String("events", filepath.Join("testdata", "events"), "directory of the sample events, relative to the application directory")
+	verbose := fs.Bool("v", false, "log each sample event as it is tested")
+	a, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	eventsDir := *events
+	if !filepath.IsAbs(eventsDir) {
+		eventsDir = filepath.Join(a.dir, eventsDir)
+	}
+	files, err := filepath.Glob(filepath.Join(eventsDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(sampleEvents(files)) == 0 {
+		return fmt.Errorf("no sample events in %s", eventsDir)
+	}
+
+	plan, err := a.plan()
+	if err != nil {
+		return err
+	}
+	var path string
+	for _, entry := range plan.Entries {
+		if protocol, _ := entry.Metadata["protocol"].(string); protocol != "http" {
+			return fmt.Errorf("contract tests support the http protocol, not %q", protocol)
+		}
+		path, _ = entry.Metadata["path"].(string)
+	}
+
+	layersDir, err := ioutil.TempDir("", "ce-fn")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layersDir)
+	layer, err := a.scaffold(plan, layersDir)
+	if err != nil {
+		return err
+	}
+
+	// Overlay the contract test onto the command package, along with the
+	// generated files, without changing the layer.
+	ov, err := function.ReadOverlay(filepath.Join(layer.Path, function.OverlayFile))
+	if err != nil {
+		return err
+	}
+	var cmdDir string
+	for target := range ov.Replace {
+		cmdDir = filepath.Dir(target)
+		break
+	}
+	for name, content := range map[string]string{contractTestFile: contractTest, contractHelpersFile: contractHelpers} {
+		p := filepath.Join(layersDir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			return err
+		}
+		ov.Replace[filepath.Join(cmdDir, name)] = p
+	}
+	ovFile := filepath.Join(layersDir, "test-"+function.OverlayFile)
+	if err := ov.Write(ovFile); err != nil {
+		return err
+	}
+
+	// The command package only exists in the overlay, so the test binary is
+	// built and run here rather than by go test in the package's directory,
+	// which vet would need as well.
+	binary := filepath.Join(layersDir, "contract.test")
+	cmd := a.goCommand(layer, []string{"-overlay=" + ovFile}, "test", "-c", "-vet=off", "-o", binary)
+	cmd.Stdout = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go test %s: %w", layer.BuildEnv["BP_GO_TARGETS.override"], err)
+	}
+
+	testArgs := []string{"-test.run=^TestContract$"}
+	if *verbose {
+		testArgs = append(testArgs, "-test.v")
+	}
+	cmd = exec.Command(binary, testArgs...)
+	cmd.Dir = a.dir
+	cmd.Env = append(os.Environ(), "CE_FN_EVENTS="+eventsDir, "CE_FN_PATH="+path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("the function doesn't respond to the sample events as expected: %w", err)
+	}
+	return nil
+}
+
+// sampleEvents returns the names of the sample events among the files.
+func sampleEvents(files []string) []string {
+	var names []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, responseSuffix) {
+			names = append(names, strings.TrimSuffix(filepath.Base(f), ".json"))
+		}
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package main
+
+// The helpers of the contract test, which only use the standard library.
+// This file is compiled into the contract test of the command package, as
+// well as into ce-fn, whose tests cover it.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// waitForReady waits for the function to serve url.
+func waitForReady(url string) error {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get(url); err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the function is not serving: %v", err)
+}
+
+// diffEvents compares the attributes and data of the event in structured
+// JSON with those of the expected event.  Attributes that are missing from
+// the expected event, such as its id and time, aren't compared.
+func diffEvents(want, got []byte) (string, error) {
+	var wantAttrs, gotAttrs map[string]interface{}
+	if err := json.Unmarshal(want, &wantAttrs); err != nil {
+		return "", fmt.Errorf("malformed expected response: %v", err)
+	}
+	if err := json.Unmarshal(got, &gotAttrs); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(wantAttrs))
+	for k := range wantAttrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		if reflect.DeepEqual(wantAttrs[k], gotAttrs[k]) {
+			continue
+		}
+		w, _ := json.Marshal(wantAttrs[k])
+		g, _ := json.Marshal(gotAttrs[k])
+		fmt.Fprintf(&b, "-%s: %s\n+%s: %s\n", k, w, k, g)
+	}
+	return b.String(), nil
+}
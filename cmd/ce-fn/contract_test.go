@@ -0,0 +1,218 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffEvents(t *testing.T) {
+	const got = `{"specversion":"1.0","id":"3a1c","source":"https://example.com/fn","type":"com.example.reply","time":"2021-01-02T03:04:05Z","datacontenttype":"application/json","data":{"A":1}}`
+
+	tests := []struct {
+		name string
+		want string
+		diff string
+		err  string
+	}{{
+		name: "same event",
+		want: got,
+	}, {
+		name: "attributes left out",
+		want: `{"type":"com.example.reply","data":{"A":1}}`,
+	}, {
+		name: "different data",
+		want: `{"type":"com.example.reply","data":{"A":2}}`,
+		diff: "-data: {\"A\":2}\n+data: {\"A\":1}\n",
+	}, {
+		name: "different attributes",
+		want: `{"type":"com.example.other","source":"https://example.com/fn","subject":"x"}`,
+		diff: "-subject: \"x\"\n+subject: null\n-type: \"com.example.other\"\n+type: \"com.example.reply\"\n",
+	}, {
+		name: "malformed response",
+		want: `{"type":`,
+		err:  "malformed expected response",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := diffEvents([]byte(test.want), []byte(got))
+			switch {
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("diffEvents() = %v, wanted error containing %q", err, test.err)
+				}
+			case err != nil:
+				t.Error("diffEvents() =", err)
+			case diff != test.diff:
+				t.Errorf("diffEvents() = %q, wanted %q", diff, test.diff)
+			}
+		})
+	}
+}
+
+func TestSampleEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{{
+		name: "no files",
+	}, {
+		name:  "events",
+		files: []string{"testdata/events/order.json", "testdata/events/refund.json"},
+		want:  []string{"order", "refund"},
+	}, {
+		name:  "responses",
+		files: []string{"testdata/events/order.json", "testdata/events/order.response.json"},
+		want:  []string{"order"},
+	}, {
+		name:  "only responses",
+		files: []string{"testdata/events/order.response.json"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sampleEvents(test.files); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sampleEvents() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestContractSource checks that the contract test and its helpers form
+// the test files of a main package, which only import the packages that the
+// scaffolding of the http protocol provides.
+func TestContractSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		funcs   []string
+		imports []string
+	}{{
+		name:    contractTestFile,
+		source:  contractTest,
+		funcs:   []string{"TestContract"},
+		imports: []string{"github.com/cloudevents/sdk-go/v2", "github.com/cloudevents/sdk-go/v2/binding", "github.com/cloudevents/sdk-go/v2/protocol/http"},
+	}, {
+		name:   contractHelpersFile,
+		source: contractHelpers,
+		funcs:  []string{"waitForReady", "diffEvents"},
+	}}
+
+	fset := token.NewFileSet()
+	declared := make(map[string]string)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := parser.ParseFile(fset, test.name, test.source, 0)
+			if err != nil {
+				t.Fatal("ParseFile() =", err)
+			}
+			if f.Name.Name != "main" {
+				t.Errorf("package %s, wanted main", f.Name.Name)
+			}
+
+			var funcs []string
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok {
+					funcs = append(funcs, fd.Name.Name)
+					if other, ok := declared[fd.Name.Name]; ok {
+						t.Errorf("%s is declared in %s as well", fd.Name.Name, other)
+					}
+					declared[fd.Name.Name] = test.name
+				}
+			}
+			if !reflect.DeepEqual(funcs, test.funcs) {
+				t.Errorf("functions = %q, wanted %q", funcs, test.funcs)
+			}
+
+			var imports []string
+			for _, spec := range f.Imports {
+				imp, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					t.Fatal("Unquote() =", err)
+				}
+				if strings.Contains(strings.SplitN(imp, "/", 2)[0], ".") {
+					imports = append(imports, imp)
+				}
+			}
+			if !reflect.DeepEqual(imports, test.imports) {
+				t.Errorf("imports outside the standard library = %q, wanted %q", imports, test.imports)
+			}
+		})
+	}
+
+	if !strings.Contains(contractTest, "const responseSuffix = `"+responseSuffix+"`") {
+		t.Errorf("the contract test doesn't declare responseSuffix as %q", responseSuffix)
+	}
+}
+
+// TestContract runs the contract test of the function in testdata/contract
+// against sample events whose expected responses match and don't.  It
+// downloads the modules that the function requires, so it only runs when
+// SCAFFOLDING_TESTS is set, as in the e2e workflow.
+func TestContract(t *testing.T) {
+	if os.Getenv("SCAFFOLDING_TESTS") == "" {
+		t.Skip("set SCAFFOLDING_TESTS=1 to run the contract test of a sample function")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+
+	tests := []struct {
+		name    string
+		events  string
+		want    []string
+		wantErr string
+	}{{
+		name:   "matching response",
+		events: "match",
+		want:   []string{"--- PASS: TestContract/order"},
+	}, {
+		name:    "mismatching response",
+		events:  "mismatch",
+		want:    []string{"response (-want, +got):", `-type: "com.example.refund"`, `+type: "com.example.confirmation"`},
+		wantErr: "the function doesn't respond to the sample events as expected",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The contract test writes its results to stdout.
+			out, err := ioutil.TempFile(t.TempDir(), "stdout")
+			if err != nil {
+				t.Fatal("TempFile() =", err)
+			}
+			defer out.Close()
+			stdout := os.Stdout
+			os.Stdout = out
+			err = testCmd([]string{"-v", "-events", filepath.Join("events", test.events), filepath.Join("testdata", "contract")})
+			os.Stdout = stdout
+
+			switch {
+			case test.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("testCmd() = %v, wanted error containing %q", err, test.wantErr)
+				}
+			case err != nil:
+				t.Error("testCmd() =", err)
+			}
+			got, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal("ReadFile() =", err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("testCmd() wrote %q, wanted it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
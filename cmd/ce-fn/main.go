@@ -0,0 +1,351 @@
+// ce-fn runs the detection and build of the buildpack without pack, so that
+// functions can be checked and built locally and in CI.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/paketo-buildpacks/packit"
+	"github.com/paketo-buildpacks/packit/scribe"
+
+	"github.com/mattmoor/cloudevents-go-fn/pkg/function"
+)
+
+// buildpackID is the ID of the buildpack, as in buildpacks/buildpack.toml.
+const buildpackID = "io.mattmoor.cloudevents.golang.functions"
+
+// version is the version that ce-fn reports as the buildpack's.
+var version = "devel"
+
+const usage = `ce-fn detects, generates and builds CloudEvents functions without pack.
+
+Usage:
+
+	ce-fn detect [flags] [dir]          print the build plan of the function
+	ce-fn generate -o out [flags] [dir] write the scaffolding to out
+	ce-fn build [-o binary] [flags] [dir]
+	                                    build the function into a binary
+	ce-fn serve [-port port] [flags] [dir]
+	                                    run the function, and rebuild and
+	                                    restart it when its source changes
+	ce-fn test [-events dir] [flags] [dir]
+	                                    send the sample events to the function,
+	                                    and check its responses
+
+dir is the application directory, which defaults to the current directory.
+The function is configured with the same CE_* environment variables as the
+buildpack.  Run "ce-fn <command> -h" for the flags of each command.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ce-fn: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "detect":
+		err = detectCmd(args)
+	case "generate":
+		err = generateCmd(args)
+	case "build":
+		err = buildCmd(args)
+	case "serve":
+		err = serveCmd(args)
+	case "test":
+		err = testCmd(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "ce-fn: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// app holds the flags that are common to all commands.
+type app struct {
+	// dir is the application directory.
+	dir string
+	// buildpack is the directory of the buildpack, whose signatures.json
+	// is used instead of the built-in signatures when set.
+	buildpack string
+}
+
+// parse registers the common flags on fs, parses args, and returns the
+// application.
+func parse(fs *flag.FlagSet, args []string) (*app, error) {
+	a := &app{}
+	fs.StringVar(&a.buildpack, "buildpack", "", "directory of the buildpack whose signatures.json to use, instead of the built-in signatures")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	switch fs.NArg() {
+	case 0:
+		a.dir = "."
+	case 1:
+		a.dir = fs.Arg(0)
+	default:
+		return nil, fmt.Errorf("%s takes at most one application directory, got %q", fs.Name(), fs.Args())
+	}
+	dir, err := filepath.Abs(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	a.dir = dir
+	return a, nil
+}
+
+// plan runs the detection, and returns the plan of the build.
+func (a *app) plan() (packit.BuildpackPlan, error) {
+	d := function.Detector{}
+	if err := envconfig.Process("", &d); err != nil {
+		return packit.BuildpackPlan{}, err
+	}
+	result, err := d.Detect(packit.DetectContext{
+		WorkingDir: a.dir,
+		CNBPath:    a.buildpack,
+		BuildpackInfo: packit.BuildpackInfo{
+			ID:      buildpackID,
+			Version: version,
+		},
+	})
+	if err != nil {
+		return packit.BuildpackPlan{}, err
+	}
+
+	var plan packit.BuildpackPlan
+	for _, req := range result.Plan.Requires {
+		md, _ := req.Metadata.(map[string]interface{})
+		plan.Entries = append(plan.Entries, packit.BuildpackPlanEntry{
+			Name:     req.Name,
+			Metadata: md,
+		})
+	}
+	return plan, nil
+}
+
+// scaffold runs the build of the plan, which generates the scaffolding into a
+// layer in layersDir, and returns that layer.
+func (a *app) scaffold(plan packit.BuildpackPlan, layersDir string) (packit.Layer, error) {
+	// The build log goes to stderr, leaving stdout to the output of the
+	// command.
+	b := function.Builder{
+		Logger: scribe.NewLogger(os.Stderr),
+	}
+	if err := envconfig.Process("", &b); err != nil {
+		return packit.Layer{}, err
+	}
+	result, err := b.Build(packit.BuildContext{
+		WorkingDir: a.dir,
+		CNBPath:    a.buildpack,
+		Plan:       plan,
+		Layers:     packit.Layers{Path: layersDir},
+		BuildpackInfo: packit.BuildpackInfo{
+			ID:      buildpackID,
+			Name:    "ce-fn",
+			Version: version,
+		},
+	})
+	if err != nil {
+		return packit.Layer{}, err
+	}
+	if len(result.Layers) != 1 {
+		return packit.Layer{}, fmt.Errorf("the build produced %d layers, expected 1", len(result.Layers))
+	}
+	layer := result.Layers[0]
+	if err := writeMetadata(layersDir, layer); err != nil {
+		return packit.Layer{}, err
+	}
+	return layer, nil
+}
+
+// writeMetadata writes the metadata of the layer to <name>.toml in layersDir,
+// as the lifecycle would, so that the next build in layersDir can reuse it.
+func writeMetadata(layersDir string, layer packit.Layer) error {
+	keys := make([]string, 0, len(layer.Metadata))
+	for k := range layer.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "build = %t\ncache = %t\nlaunch = %t\n\n[metadata]\n", layer.Build, layer.Cache, layer.Launch)
+	for _, k := range keys {
+		v, ok := layer.Metadata[k].(string)
+		if !ok {
+			return fmt.Errorf("layer %s: metadata %q is not a string", layer.Name, k)
+		}
+		fmt.Fprintf(&b, "  %s = %q\n", k, v)
+	}
+	return ioutil.WriteFile(filepath.Join(layersDir, layer.Name+".toml"), []byte(b.String()), 0644)
+}
+
+// generatedFiles returns the files that the layer overlays onto the main
+// module, keyed by their name.
+func generatedFiles(layer packit.Layer) (map[string]string, error) {
+	ov, err := function.ReadOverlay(filepath.Join(layer.Path, function.OverlayFile))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(ov.Replace))
+	for target, p := range ov.Replace {
+		files[filepath.Base(target)] = p
+	}
+	return files, nil
+}
+
+func detectCmd(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	a, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	plan, err := a.plan()
+	if err != nil {
+		return err
+	}
+
+	out := make(map[string]map[string]interface{}, len(plan.Entries))
+	for _, entry := range plan.Entries {
+		out[entry.Name] = entry.Metadata
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+func generateCmd(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := fs.String("o", "", "directory to write the scaffolding to (required)")
+	a, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("generate requires a directory to write the scaffolding to with -o")
+	}
+
+	layersDir, err := ioutil.TempDir("", "ce-fn")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layersDir)
+	plan, err := a.plan()
+	if err != nil {
+		return err
+	}
+	layer, err := a.scaffold(plan, layersDir)
+	if err != nil {
+		return err
+	}
+	files, err := generatedFiles(layer)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := ioutil.ReadFile(files[name])
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(*out, name)
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			return err
+		}
+		fmt.Println(p)
+	}
+	return nil
+}
+
+func buildCmd(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("o", "function", "path of the binary to build")
+	a, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	binary, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+
+	layersDir, err := ioutil.TempDir("", "ce-fn")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layersDir)
+	if err := a.build(layersDir, binary); err != nil {
+		return err
+	}
+	fmt.Println(binary)
+	return nil
+}
+
+// build generates the scaffolding into a layer in layersDir, and builds the
+// function into binary.
+func (a *app) build(layersDir, binary string) error {
+	plan, err := a.plan()
+	if err != nil {
+		return err
+	}
+	layer, err := a.scaffold(plan, layersDir)
+	if err != nil {
+		return err
+	}
+	cmd := a.goCommand(layer, nil, "build", "-o", binary)
+	cmd.Stdout = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build %s: %w", layer.BuildEnv["BP_GO_TARGETS.override"], err)
+	}
+	return nil
+}
+
+// goCommand returns a go command with the given arguments followed by the
+// command package, which runs the way that the Go buildpack would, with the
+// environment that the layer sets for it.  The extra flags are added to
+// GOFLAGS after those of the layer, so that they take precedence.  The
+// linker flags of BP_GO_BUILD_LDFLAGS are passed with -ldflags, as the Go
+// buildpack does.
+func (a *app) goCommand(layer packit.Layer, extra []string, args ...string) *exec.Cmd {
+	env := layer.BuildEnv
+	goflags := append([]string{os.Getenv("GOFLAGS"), env["GOFLAGS.append"]}, extra...)
+	ldflags := strings.Fields(os.Getenv("BP_GO_BUILD_LDFLAGS") + " " + env["BP_GO_BUILD_LDFLAGS.append"])
+	if len(ldflags) > 0 {
+		args = append([]string{args[0], "-ldflags=" + strings.Join(ldflags, " ")}, args[1:]...)
+	}
+
+	cmd := exec.Command("go", append(args, env["BP_GO_TARGETS.override"])...)
+	cmd.Dir = a.dir
+	cmd.Env = append(os.Environ(), "GOFLAGS="+strings.Join(strings.Fields(strings.Join(goflags, " ")), " "))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit"
+
+	"github.com/mattmoor/cloudevents-go-fn/pkg/function"
+)
+
+func TestParse(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Getwd() =", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want app
+		err  string
+	}{{
+		name: "current directory",
+		want: app{dir: wd},
+	}, {
+		name: "application directory",
+		args: []string{"./app"},
+		want: app{dir: filepath.Join(wd, "app")},
+	}, {
+		name: "absolute directory",
+		args: []string{"/src/app"},
+		want: app{dir: "/src/app"},
+	}, {
+		name: "buildpack",
+		args: []string{"-buildpack", "../buildpacks", "app"},
+		want: app{dir: filepath.Join(wd, "app"), buildpack: "../buildpacks"},
+	}, {
+		name: "several directories",
+		args: []string{"app", "other"},
+		err:  `detect takes at most one application directory, got ["app" "other"]`,
+	}, {
+		name: "flag after the directory",
+		args: []string{"app", "-buildpack", "../buildpacks"},
+		err:  "detect takes at most one application directory",
+	}, {
+		name: "unknown flag",
+		args: []string{"-bogus", "app"},
+		err:  "flag provided but not defined: -bogus",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			got, err := parse(fs, test.args)
+			switch {
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("parse() = %v, wanted error containing %q", err, test.err)
+				}
+			case err != nil:
+				t.Error("parse() =", err)
+			case *got != test.want:
+				t.Errorf("parse() = %+v, wanted %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	layer := packit.Layer{Name: "ce-go-function-cmd", Path: dir}
+	if _, err := generatedFiles(layer); err == nil {
+		t.Error("generatedFiles() = nil, wanted an error without an overlay")
+	}
+
+	ov := function.Overlay{Replace: map[string]string{
+		"/app/ce-cmd/function/main.go": filepath.Join(dir, "main.go"),
+		"/app/ce-cmd/function/http.go": filepath.Join(dir, "http.go"),
+	}}
+	if err := ov.Write(filepath.Join(dir, function.OverlayFile)); err != nil {
+		t.Fatal("Write() =", err)
+	}
+	got, err := generatedFiles(layer)
+	if err != nil {
+		t.Fatal("generatedFiles() =", err)
+	}
+	want := map[string]string{
+		"main.go": filepath.Join(dir, "main.go"),
+		"http.go": filepath.Join(dir, "http.go"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("generatedFiles() = %v, wanted %v", got, want)
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		want     string
+		err      string
+	}{{
+		name: "no metadata",
+		want: "build = true\ncache = true\nlaunch = false\n\n[metadata]\n",
+	}, {
+		name: "sorted keys",
+		metadata: map[string]interface{}{
+			"digest": "sha256:abc",
+			"b":      `quoted "value"`,
+		},
+		want: "build = true\ncache = true\nlaunch = false\n\n[metadata]\n  b = \"quoted \\\"value\\\"\"\n  digest = \"sha256:abc\"\n",
+	}, {
+		name:     "not a string",
+		metadata: map[string]interface{}{"count": 1},
+		err:      `metadata "count" is not a string`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			layer := packit.Layer{
+				Name:     "ce-go-function-cmd",
+				Build:    true,
+				Cache:    true,
+				Metadata: test.metadata,
+			}
+			err := writeMetadata(dir, layer)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("writeMetadata() = %v, wanted error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("writeMetadata() =", err)
+			}
+			got, err := ioutil.ReadFile(filepath.Join(dir, "ce-go-function-cmd.toml"))
+			if err != nil {
+				t.Fatal("ReadFile() =", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("writeMetadata() wrote %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
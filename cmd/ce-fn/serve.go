@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := fs.Int("port", 8080, "port on which the function receives events")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the source for changes")
+	a, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// The layer is kept across rebuilds, so that the scaffolding is only
+	// regenerated when its inputs change.
+	layersDir, err := ioutil.TempDir("", "ce-fn")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layersDir)
+	binary := filepath.Join(layersDir, "function")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		stamp, err := a.snapshot()
+		if err != nil {
+			return err
+		}
+
+		// Errors in the detection and the build are reported, and the next
+		// attempt waits for the source to change.
+		var fn *exec.Cmd
+		exited := make(chan error, 1)
+		if err := a.build(layersDir, binary); err != nil {
+			log.Printf("%v", err)
+			log.Print("Waiting for changes")
+		} else {
+			fn = exec.Command(binary)
+			fn.Env = append(os.Environ(), "PORT="+strconv.Itoa(*port))
+			fn.Stdout = os.Stdout
+			fn.Stderr = os.Stderr
+			if err := fn.Start(); err != nil {
+				return err
+			}
+			log.Printf("Serving the function on port %d", *port)
+			go func() { exited <- fn.Wait() }()
+		}
+
+		changed, running, err := a.waitForChange(stamp, *interval, stop, exited)
+		if fn != nil && running {
+			terminate(fn, exited)
+		}
+		if err != nil || !changed {
+			return err
+		}
+		log.Print("The source changed, rebuilding")
+	}
+}
+
+// waitForChange polls the source until it differs from stamp, and returns
+// true, or returns false when the command is stopped.  When the function
+// exits in the meantime, it is reported and polling continues.  It also
+// returns whether the function is still running.
+func (a *app) waitForChange(stamp string, interval time.Duration, stop <-chan os.Signal, exited <-chan error) (changed, running bool, err error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return false, exited != nil, nil
+		case err := <-exited:
+			exited = nil
+			if err != nil {
+				log.Printf("The function exited: %v", err)
+			} else {
+				log.Print("The function exited")
+			}
+			log.Print("Waiting for changes")
+		case <-ticker.C:
+			s, err := a.snapshot()
+			if err != nil {
+				return false, exited != nil, err
+			}
+			if s != stamp {
+				return true, exited != nil, nil
+			}
+		}
+	}
+}
+
+// terminate stops the function, and waits for it to exit.
+func terminate(fn *exec.Cmd, exited <-chan error) {
+	// The scaffolding drains requests for a grace period on SIGTERM, which
+	// only delays a restart here, so interrupt it instead.
+	if err := fn.Process.Signal(os.Interrupt); err != nil {
+		fn.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		fn.Process.Kill()
+		<-exited
+	}
+}
+
+// snapshot returns a digest of the names, sizes and modification times of
+// the files in the application directory that the function is built from.
+func (a *app) snapshot() (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(a.dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := fi.Name()
+		if fi.IsDir() {
+			if p != a.dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !watched(name) {
+			return nil
+		}
+		fmt.Fprintf(h, "%s %d %d\n", p, fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// watched returns whether changes to the file with the given name trigger a
+// rebuild.
+func watched(name string) bool {
+	switch {
+	case strings.HasSuffix(name, "_test.go"):
+		return false
+	case strings.HasSuffix(name, ".go"), strings.HasSuffix(name, ".go.tmpl"):
+		return true
+	}
+	switch name {
+	case "go.mod", "go.sum", "go.work", "modules.txt":
+		return true
+	}
+	return false
+}
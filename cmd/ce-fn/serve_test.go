@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatched(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{{
+		name: "fn.go",
+		want: true,
+	}, {
+		name: "fn_test.go",
+	}, {
+		name: "main.go.tmpl",
+		want: true,
+	}, {
+		name: "go.mod",
+		want: true,
+	}, {
+		name: "go.sum",
+		want: true,
+	}, {
+		name: "go.work",
+		want: true,
+	}, {
+		name: "modules.txt",
+		want: true,
+	}, {
+		name: "README.md",
+	}, {
+		name: "project.toml",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := watched(test.name); got != test.want {
+				t.Errorf("watched(%q) = %t, wanted %t", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		changed bool
+	}{{
+		name:    "source",
+		file:    "fn.go",
+		changed: true,
+	}, {
+		name:    "new source",
+		file:    "sub/other.go",
+		changed: true,
+	}, {
+		name:    "go.sum",
+		file:    "go.sum",
+		changed: true,
+	}, {
+		name:    "template",
+		file:    "templates/main.go.tmpl",
+		changed: true,
+	}, {
+		name: "test",
+		file: "fn_test.go",
+	}, {
+		name: "testdata",
+		file: "testdata/events/event.go",
+	}, {
+		name: "hidden directory",
+		file: ".git/fn.go",
+	}, {
+		name: "other file",
+		file: "README.md",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &app{dir: t.TempDir()}
+			write := func(name, content string) {
+				p := filepath.Join(a.dir, name)
+				if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+					t.Fatal("MkdirAll() =", err)
+				}
+				if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+				// Make sure that the modification time changes.
+				later := time.Now().Add(time.Minute)
+				if err := os.Chtimes(p, later, later); err != nil {
+					t.Fatal("Chtimes() =", err)
+				}
+			}
+			write("go.mod", "module example.com/fn\n")
+			write("fn.go", "package fn\n")
+
+			before, err := a.snapshot()
+			if err != nil {
+				t.Fatal("snapshot() =", err)
+			}
+			write(test.file, "package fn\n\n// Changed.\n")
+			after, err := a.snapshot()
+			if err != nil {
+				t.Fatal("snapshot() =", err)
+			}
+			if changed := before != after; changed != test.changed {
+				t.Errorf("snapshot() changed = %t, wanted %t", changed, test.changed)
+			}
+		})
+	}
+}
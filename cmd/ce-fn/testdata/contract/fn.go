@@ -0,0 +1,19 @@
+package fn
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Receiver confirms orders.
+func Receiver(ctx context.Context, e cloudevents.Event) (*cloudevents.Event, error) {
+	reply := cloudevents.NewEvent()
+	reply.SetID(e.ID())
+	reply.SetSource("https://example.com/fn")
+	reply.SetType("com.example.confirmation")
+	if err := reply.SetData(cloudevents.ApplicationJSON, e.Data()); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
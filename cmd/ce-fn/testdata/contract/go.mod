@@ -0,0 +1,5 @@
+module example.com/contract
+
+go 1.14
+
+require github.com/cloudevents/sdk-go/v2 v2.3.1
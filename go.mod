@@ -1,11 +1,22 @@
 module github.com/mattmoor/cloudevents-go-fn
 
-go 1.14
+go 1.21
 
 require (
 	github.com/google/go-cmp v0.4.1
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/paketo-buildpacks/packit v0.4.0
 	github.com/vaikas/gofunctypechecker v0.0.0-20201124220306-6636ad28e8e8
-	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/mod v0.12.0
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/VividCortex/ewma v1.1.1 // indirect
+	github.com/cheggaaa/pb/v3 v3.0.5 // indirect
+	github.com/fatih/color v1.9.0 // indirect
+	github.com/mattn/go-colorable v0.1.4 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/mattn/go-runewidth v0.0.8 // indirect
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
 )
@@ -7,4 +7,4 @@ pushd buildpacks/bin
 ln -s -r run detect
 ln -s -r run build
 popd
-pack package-buildpack "${@}"
+pack buildpack package "${@}"
@@ -1,10 +1,18 @@
 package function
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/paketo-buildpacks/packit"
 	"github.com/paketo-buildpacks/packit/scribe"
@@ -15,6 +23,26 @@ import (
 type Builder struct {
 	// Logger is used to emit waypoints through the build phase of th elifecycle.
 	Logger scribe.Logger
+
+	// Check holds whether the generated scaffolding is type-checked against
+	// the user's package, which requires the go command: "true" checks it
+	// when the go command is on PATH, and warns that it is skipped
+	// otherwise, "required" fails the build without the go command, and
+	// "false" (or empty) skips it.  The go command is only on PATH when a
+	// buildpack that installs Go, such as paketo-buildpacks/go-dist, runs
+	// before this one.
+	Check string `envconfig:"CE_GO_CHECK_SCAFFOLDING" default:"true"`
+
+	// TemplateDir holds the path of a directory (relative to the application
+	// directory) with templates that override or extend the scaffolding.
+	// Each <name>.go.tmpl file renders <name>.go in the command package,
+	// and is executed with a TemplateData.
+	TemplateDir string `envconfig:"CE_TEMPLATE_DIR"`
+
+	// Revision holds the VCS revision of the application, which is stamped
+	// into the binary.  By default, it is read from the application's git
+	// repository, if any.
+	Revision string `envconfig:"CE_VCS_REVISION"`
 }
 
 const targetPackage = "./ce-cmd/function"
@@ -24,69 +52,459 @@ func (b *Builder) Build(bctx packit.BuildContext) (packit.BuildResult, error) {
 	b.Logger.Title("%s %s", bctx.BuildpackInfo.Name, bctx.BuildpackInfo.Version)
 	defer b.Logger.Break()
 
-	info, err := b.getInfo(bctx)
+	data, err := b.templateData(bctx)
 	if err != nil {
 		return packit.BuildResult{}, err
 	}
-	b.Logger.Process("Package:  %s", info.Package)
-	b.Logger.Process("Function: %s", info.Function)
-	b.Logger.Process("Protocol: %s", info.Protocol)
+	b.Logger.Process("Package:  %s", data.Package)
+	if len(data.Routes) == 0 {
+		b.Logger.Process("Function: %s", data.Function)
+		if data.Constructor != "" {
+			b.Logger.Process("Constructor: %s", data.Constructor)
+		}
+	} else {
+		b.Logger.Process("Routes:")
+		for _, r := range data.Routes {
+			b.Logger.Subprocess("%s: types %s source %q", r.Function, strings.Join(r.Types, ","), r.Source)
+		}
+	}
+	b.Logger.Process("Protocol: %s", data.Protocol)
 
-	if err := os.MkdirAll(filepath.Join(bctx.WorkingDir, targetPackage), os.ModePerm); err != nil {
+	// The Go buildpack runs after this one, so the go command is only
+	// found here when the build image or an earlier buildpack provides it,
+	// and then it must be able to build the overlay.
+	_, noGo := exec.LookPath("go")
+	if noGo == nil {
+		if err := checkGoVersion(); err != nil {
+			return packit.BuildResult{}, err
+		}
+	}
+	check, err := b.checkScaffolding(noGo)
+	if err != nil {
 		return packit.BuildResult{}, err
 	}
 
-	for _, file := range []string{"main", info.Protocol} {
-		err := func() error { // Scope the defer
-			p := filepath.Join(bctx.WorkingDir, targetPackage, file+".go")
-			mg, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, os.ModePerm)
-			if err != nil {
-				return err
-			}
-			defer mg.Close()
+	moduleDir := filepath.Join(bctx.WorkingDir, data.ModuleRoot)
+	target, err := buildTarget(bctx.WorkingDir, moduleDir, data.ModuleRoot)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	mod, err := readModule(moduleDir)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	data.Build = BuildInfo{
+		Buildpack:        bctx.BuildpackInfo.ID,
+		BuildpackVersion: bctx.BuildpackInfo.Version,
+		SDKVersion:       mod.requiredVersion(sdkModule),
+	}
 
-			tmpl, ok := templates[file]
-			if !ok {
-				return fmt.Errorf("unsupported template: %q", file)
-			}
+	templates, err := loadTemplates(bctx.WorkingDir, b.TemplateDir, data.Protocol)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	// The command package only exists in the overlay, so make sure that it
+	// doesn't merge with a package of the user's.
+	cmdDir := filepath.Join(moduleDir, targetPackage)
+	if _, err := os.Stat(cmdDir); err == nil {
+		return packit.BuildResult{}, fmt.Errorf("%s is reserved for the generated scaffolding, please rename it", filepath.Join(data.ModuleRoot, targetPackage))
+	} else if !os.IsNotExist(err) {
+		return packit.BuildResult{}, err
+	}
+
+	layer, err := bctx.Layers.Get("ce-go-function-cmd", packit.BuildLayer, packit.CacheLayer)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	pkgDir, err := packageDir(bctx.WorkingDir, moduleDir, data.Package)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	sources, err := buildFiles(pkgDir, buildTags(data.Protocol))
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	goflags := os.Getenv("GOFLAGS")
+	digest, err := layerInputs{
+		Data:      data,
+		Templates: templates,
+		CmdDir:    cmdDir,
+		GoFlags:   goflags,
+		Check:     check,
+	}.digest(moduleDir, sources)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	ovFile := filepath.Join(layer.Path, OverlayFile)
+	if ok, reason := cached(layer, digest); ok {
+		b.Logger.Process("Reusing cached layer %s", layer.Path)
+		b.Logger.Subprocess("%s", reason)
+	} else {
+		b.Logger.Process("Generating the scaffolding")
+		b.Logger.Subprocess("%s", reason)
 
-			return tmpl.Execute(mg, info)
-		}()
+		files, err := generate(data, templates)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
+		if err := checkRequirements(bctx.WorkingDir, moduleDir, goflags, data, files); err != nil {
+			return packit.BuildResult{}, err
+		}
+		if check {
+			if err := checkGenerated(moduleDir, data, files); err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		if err := layer.Reset(); err != nil {
+			return packit.BuildResult{}, err
+		}
+		ov := Overlay{Replace: make(map[string]string, len(files))}
+		for _, f := range files {
+			p := filepath.Join(layer.Path, f.Name)
+			if err := ioutil.WriteFile(p, f.Source, 0644); err != nil {
+				return packit.BuildResult{}, err
+			}
+			ov.Replace[filepath.Join(cmdDir, f.Name)] = p
+		}
+		if err := ov.Write(ovFile); err != nil {
+			return packit.BuildResult{}, err
+		}
+		layer.Metadata = map[string]interface{}{
+			digestKey: digest,
+		}
+	}
+
+	labels, err := data.labels()
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	info, err := b.buildInfo(bctx.WorkingDir, data, labels)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	layer.BuildEnv.Override("BP_GO_TARGETS", target)
+	layer.BuildEnv.Append("GOFLAGS", fmt.Sprintf("-tags=%s -overlay=%s", data.Protocol, ovFile), " ")
+	// The Go buildpack passes BP_GO_BUILD_LDFLAGS with -ldflags, so the
+	// stamp is added to those of the application rather than to GOFLAGS.
+	layer.BuildEnv.Append("BP_GO_BUILD_LDFLAGS", ldflags(info), " ")
+	if setsLdflags(goflags) {
+		b.Logger.Process("Warning: the -ldflags in GOFLAGS are replaced by those of BP_GO_BUILD_LDFLAGS, set them there instead")
 	}
 
 	return packit.BuildResult{
-		Layers: []packit.Layer{{
-			Name:  "ce-go-function-cmd",
-			Path:  filepath.Join(bctx.Layers.Path, "ce-go-function-cmd"),
-			Build: true,
-			BuildEnv: packit.Environment{
-				"BP_GO_TARGETS.override": targetPackage,
-				"GOFLAGS.append":         fmt.Sprint(" -tags=", info.Protocol),
-			},
-		}},
+		Layers: []packit.Layer{layer},
+		Launch: packit.LaunchMetadata{
+			// The Go buildpack names the binary after the command package,
+			// and puts it on the PATH at launch.
+			Processes: []packit.Process{{
+				Type:    processType,
+				Command: path.Base(targetPackage),
+				Direct:  true,
+			}},
+			Labels: labels,
+		},
 	}, nil
 }
 
-type info struct {
-	Package  string
-	Function string
-	Protocol string
+// checkScaffolding returns whether the scaffolding is type-checked, given
+// the error of looking up the go command, according to Check.
+func (b *Builder) checkScaffolding(noGo error) (bool, error) {
+	switch b.Check {
+	case "", "false":
+		return false, nil
+	case "true", "required":
+	default:
+		return false, fmt.Errorf("CE_GO_CHECK_SCAFFOLDING must be true, false or required, got %q", b.Check)
+	}
+	if noGo == nil {
+		return true, nil
+	}
+	const order = "run a buildpack that installs Go, such as paketo-buildpacks/go-dist, before this one"
+	if b.Check == "required" {
+		return false, fmt.Errorf("CE_GO_CHECK_SCAFFOLDING=required needs the go command to type-check the scaffolding, but %v; %s", noGo, order)
+	}
+	b.Logger.Process("Warning: the scaffolding is not type-checked, as the go command is not on PATH.  To type-check it, %s, or set CE_GO_CHECK_SCAFFOLDING=required to enforce it", order)
+	return false, nil
 }
 
-func (b *Builder) getInfo(bctx packit.BuildContext) (*info, error) {
+// buildTarget returns the command package, as the Go buildpack builds it
+// from the application directory.  That buildpack has no setting for the
+// directory that it builds in, so when the main module is in a subdirectory,
+// the application directory needs a go.work workspace that uses it.
+func buildTarget(workingDir, moduleDir, root string) (string, error) {
+	if root == "." {
+		return targetPackage, nil
+	}
+	uses, err := workspaceUses(workingDir, workingDir)
+	if err != nil {
+		return "", err
+	}
+	if !uses[moduleDir] {
+		return "", fmt.Errorf("the Go buildpack builds from the application directory, so it needs a go.work that uses the module in %s, e.g.:\n\ngo 1.18\n\nuse %s",
+			root, localPath(workingDir, moduleDir))
+	}
+	return "./" + path.Join(filepath.ToSlash(root), targetPackage), nil
+}
+
+// minGoVersion is the first Go release whose go build supports -overlay.
+const minGoVersion = 16
+
+// goRelease matches the Go 1 release in the output of go version.
+var goRelease = regexp.MustCompile(`\bgo1\.(\d+)`)
+
+// checkGoVersion checks that the go command supports -overlay.
+func checkGoVersion() error {
+	out, err := exec.Command("go", "version").Output()
+	if err != nil {
+		return fmt.Errorf("go version: %w", err)
+	}
+	return checkGoRelease(strings.TrimSpace(string(out)))
+}
+
+// checkGoRelease checks that the output of go version describes a release
+// that supports -overlay.
+func checkGoRelease(version string) error {
+	m := goRelease.FindStringSubmatch(version)
+	if m == nil {
+		return fmt.Errorf("unable to find the Go release in %q", version)
+	}
+	if minor, _ := strconv.Atoi(m[1]); minor < minGoVersion {
+		return fmt.Errorf("the scaffolding is built with go build -overlay, which requires Go 1.%d or later, but the build image has %s; set BP_GO_VERSION to a newer release",
+			minGoVersion, version)
+	}
+	return nil
+}
+
+// processType is the type of the process that runs the function.
+const processType = "cloudevents-function"
+
+// labelPrefix is the prefix of the image labels that describe the function.
+const labelPrefix = "io.cloudevents.function."
+
+// sdkModule is the module path of the CloudEvents SDK.
+const sdkModule = "github.com/cloudevents/sdk-go/v2"
+
+// routeLabel describes a route in the routes label.
+type routeLabel struct {
+	Function  string   `json:"function"`
+	Signature string   `json:"signature"`
+	Types     []string `json:"types"`
+	Source    string   `json:"source,omitempty"`
+}
+
+// labels returns the image labels that describe the function, so that
+// deployment tooling can read them from the image.
+func (i *TemplateData) labels() (map[string]string, error) {
+	labels := map[string]string{
+		labelPrefix + "package":  i.Package,
+		labelPrefix + "protocol": i.Protocol,
+	}
+	if i.Path != "" {
+		labels[labelPrefix+"path"] = i.Path
+	}
+	if i.Build.SDKVersion != "" {
+		labels[labelPrefix+"sdk-go-version"] = i.Build.SDKVersion
+	}
+	if len(i.Routes) == 0 {
+		labels[labelPrefix+"name"] = i.Function
+		if i.Signature != "" {
+			labels[labelPrefix+"signature"] = i.Signature
+		}
+		if len(i.Types) > 0 {
+			labels[labelPrefix+"types"] = strings.Join(i.Types, ",")
+		}
+		if i.Source != "" {
+			labels[labelPrefix+"source"] = i.Source
+		}
+		return labels, nil
+	}
+
+	routes := make([]routeLabel, 0, len(i.Routes))
+	for _, r := range i.Routes {
+		routes = append(routes, routeLabel{
+			Function:  r.Function,
+			Signature: r.Signature,
+			Types:     r.Types,
+			Source:    r.Source,
+		})
+	}
+	data, err := json.Marshal(routes)
+	if err != nil {
+		return nil, err
+	}
+	labels[labelPrefix+"routes"] = string(data)
+	return labels, nil
+}
+
+// digestKey is the key of the layer metadata that holds the digest of the
+// inputs that the scaffolding was generated from.
+const digestKey = "digest"
+
+// layerInputs holds the inputs that the scaffolding in the layer is generated
+// from, besides the files of the main module.
+type layerInputs struct {
+	Data      *TemplateData
+	Templates map[string]source
+	CmdDir    string
+	GoFlags   string
+	Check     bool
+}
+
+// moduleFiles holds the files of the main module that the generation checks
+// the scaffolding against.
+var moduleFiles = []string{"go.mod", "go.sum", filepath.Join("vendor", "modules.txt")}
+
+// digest returns a digest of the inputs, along with the files of the main
+// module in moduleDir and the source files of the function's package, which
+// the scaffolding is type-checked against.
+func (in layerInputs) digest(moduleDir string, sources []string) (string, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(in); err != nil {
+		return "", err
+	}
+	for _, name := range moduleFiles {
+		data, err := ioutil.ReadFile(filepath.Join(moduleDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+	for _, name := range sources {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// cached returns whether the layer holds scaffolding generated from inputs
+// with the given digest, along with the reason.
+func cached(layer packit.Layer, digest string) (bool, string) {
+	prev, _ := layer.Metadata[digestKey].(string)
+	switch {
+	case prev == "":
+		return false, "No cached scaffolding"
+	case prev != digest:
+		return false, fmt.Sprintf("The inputs changed: %s, previously %s", digest, prev)
+	}
+	if _, err := os.Stat(filepath.Join(layer.Path, OverlayFile)); err != nil {
+		return false, "The cached scaffolding is incomplete"
+	}
+	return true, fmt.Sprintf("The inputs are unchanged: %s", digest)
+}
+
+// OverlayFile is the name of the file in the layer that overlays the
+// generated files onto the user's module, for go build -overlay.
+const OverlayFile = "overlay.json"
+
+// Overlay is the format of the files passed to go build -overlay, which map
+// the paths of files, which need not exist, to the files that replace them.
+type Overlay struct {
+	Replace map[string]string
+}
+
+// ReadOverlay reads the overlay in the file f.
+func ReadOverlay(f string) (Overlay, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return Overlay{}, err
+	}
+	var o Overlay
+	if err := json.Unmarshal(data, &o); err != nil {
+		return Overlay{}, fmt.Errorf("malformed overlay %s: %w", f, err)
+	}
+	return o, nil
+}
+
+// Write writes the overlay to the file f.
+func (o Overlay) Write(f string) error {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f, data, 0644)
+}
+
+func (b *Builder) templateData(bctx packit.BuildContext) (*TemplateData, error) {
 	for _, entry := range bctx.Plan.Entries {
 		if entry.Name != "ce-go-function" {
 			continue
 		}
-		return &info{
-			Package:  entry.Metadata["package"].(string),
-			Function: entry.Metadata["function"].(string),
-			Protocol: entry.Metadata["protocol"].(string),
-		}, nil
+		// When the module root is omitted, it is the application directory.
+		root, _ := entry.Metadata["module-root"].(string)
+		if root == "" {
+			root = "."
+		}
+		i := &TemplateData{
+			Version:    TemplateDataVersion,
+			ModuleRoot: filepath.Clean(root),
+			Package:    entry.Metadata["package"].(string),
+			Protocol:   entry.Metadata["protocol"].(string),
+		}
+		i.Path, _ = entry.Metadata["path"].(string)
+
+		// The routes are decoded from TOML as a list of tables.
+		switch routes := entry.Metadata["routes"].(type) {
+		case []map[string]interface{}:
+			for _, md := range routes {
+				i.Routes = append(i.Routes, getRoute(md))
+			}
+		case []interface{}:
+			for _, md := range routes {
+				md, ok := md.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("malformed route for ce-go-function: %v", md)
+				}
+				i.Routes = append(i.Routes, getRoute(md))
+			}
+		}
+		if len(i.Routes) == 0 {
+			i.Route = getRoute(entry.Metadata)
+		}
+		for _, r := range i.all() {
+			if r.Function == "" {
+				return nil, errors.New("missing function for ce-go-function")
+			}
+		}
+		return i, nil
 	}
 
 	return nil, errors.New("missing metadata for ce-go-function")
 }
+
+// getRoute reads the description of a function from the plan's metadata.
+func getRoute(md map[string]interface{}) Route {
+	var r Route
+	r.Function, _ = md["function"].(string)
+	r.Signature, _ = md["signature"].(string)
+	if ctor, ok := md["constructor"].(string); ok && ctor != "" {
+		r.Constructor = ctor
+		_, r.Method = splitMethod(r.Function)
+	}
+	r.Payload, _ = md["payload"].(string)
+	r.Result, _ = md["result"].(string)
+	r.In = parseArgs(splitList(md["in"]), r.Payload, false)
+	r.Out = parseArgs(splitList(md["out"]), r.Result, true)
+	r.Native, _ = md["native"].(bool)
+	r.Adapter, _ = md["adapter"].(string)
+	r.Imports = splitList(md["imports"])
+	r.Types = splitList(md["types"])
+	r.Source, _ = md["source"].(string)
+	return r
+}
+
+// splitList splits a comma-separated list from the plan's metadata.
+func splitList(value interface{}) []string {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -2,9 +2,15 @@ package function
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/format"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -14,42 +20,283 @@ import (
 
 func TestBuild(t *testing.T) {
 	const (
-		layersPath = "/layers"
 		// These don't need to be real, we just need to be able to check them.
 		pkg   = "paketo.io/my-fn"
 		fn    = "MyHandler"
 		proto = "http"
+
+		sdkVersion = "v2.3.1"
 	)
-	wantBuildPlan := packit.BuildResult{
-		Layers: []packit.Layer{{
-			Name:  "ce-go-function-cmd",
-			Path:  filepath.Join(layersPath, "ce-go-function-cmd"),
-			Build: true,
-			BuildEnv: packit.Environment{
-				"BP_GO_TARGETS.override": targetPackage,
-				"GOFLAGS.append":         " -tags=" + proto,
-			},
-		}},
-	}
 	tests := []struct {
-		name    string
-		plan    packit.BuildpackPlan
-		success bool
+		name      string
+		plan      packit.BuildpackPlan
+		existing  bool
+		templates map[string]string
+		success   bool
+		want      TemplateData
+		labels    map[string]string
 	}{{
 		name: "successful build",
 		plan: packit.BuildpackPlan{
 			Entries: []packit.BuildpackPlanEntry{{
 				Name: "unrelated-entry",
 			}, {
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":   pkg,
+					"function":  fn,
+					"signature": "func(cloudevents.Event)",
+					"protocol":  proto,
+				},
+			}},
+		},
+		success: true,
+		want: TemplateData{
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Route: Route{
+				Function:  fn,
+				Signature: "func(cloudevents.Event)",
+			},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.name":           fn,
+			"io.cloudevents.function.signature":      "func(cloudevents.Event)",
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+		},
+	}, {
+		name: "method receiver",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":     pkg,
+					"function":    "Handler.Receive",
+					"constructor": "NewHandler",
+					"protocol":    proto,
+				},
+			}},
+		},
+		success: true,
+		want: TemplateData{
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Route: Route{
+				Function:    "Handler.Receive",
+				Constructor: "NewHandler",
+				Method:      "Receive",
+			},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.name":           "Handler.Receive",
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+		},
+	}, {
+		name: "typed payload",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":  pkg,
+					"function": fn,
+					"protocol": proto,
+					"payload":  "Order",
+					"result":   "Confirmation",
+					"adapter":  "return fn(ctx, data)",
+					"imports":  "fmt",
+				},
+			}},
+		},
+		success: true,
+		want: TemplateData{
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Route: Route{
+				Function: fn,
+				Payload:  "Order",
+				Result:   "Confirmation",
+				Adapter:  "return fn(ctx, data)",
+				Imports:  []string{"fmt"},
+			},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.name":           fn,
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+		},
+	}, {
+		name: "directive settings",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
 				Name: "ce-go-function",
 				Metadata: map[string]interface{}{
 					"package":  pkg,
 					"function": fn,
 					"protocol": proto,
+					"native":   true,
+					"adapter":  "return nil, fn(ctx, event)",
+					"path":     "/orders",
+					"types":    "com.example.order.*,com.example.refund",
 				},
 			}},
 		},
 		success: true,
+		want: TemplateData{
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Path:       "/orders",
+			Route: Route{
+				Function: fn,
+				Native:   true,
+				Adapter:  "return nil, fn(ctx, event)",
+				Types:    []string{"com.example.order.*", "com.example.refund"},
+			},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.path":           "/orders",
+			"io.cloudevents.function.name":           fn,
+			"io.cloudevents.function.types":          "com.example.order.*,com.example.refund",
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+		},
+	}, {
+		name: "routes",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":  pkg,
+					"protocol": proto,
+					"routes": []interface{}{
+						map[string]interface{}{
+							"function":  "OnOrder",
+							"signature": "func(cloudevents.Event)",
+							"native":    true,
+							"adapter":   "fn(event)\nreturn nil, nil",
+							"types":     "com.example.order.*",
+						},
+						map[string]interface{}{
+							"function":    "Refunds.Receive",
+							"signature":   "func(context.Context, cloudevents.Event) error",
+							"constructor": "NewRefunds",
+							"native":      true,
+							"adapter":     "return nil, fn(ctx, event)",
+							"types":       "com.example.refund",
+							"source":      "/billing",
+						},
+					},
+				},
+			}},
+		},
+		success: true,
+		want: TemplateData{
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Routes: []Route{{
+				Function:  "OnOrder",
+				Signature: "func(cloudevents.Event)",
+				Native:    true,
+				Adapter:   "fn(event)\nreturn nil, nil",
+				Types:     []string{"com.example.order.*"},
+			}, {
+				Function:    "Refunds.Receive",
+				Signature:   "func(context.Context, cloudevents.Event) error",
+				Constructor: "NewRefunds",
+				Method:      "Receive",
+				Native:      true,
+				Adapter:     "return nil, fn(ctx, event)",
+				Types:       []string{"com.example.refund"},
+				Source:      "/billing",
+			}},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+			"io.cloudevents.function.routes": `[{"function":"OnOrder","signature":"func(cloudevents.Event)","types":["com.example.order.*"]},` +
+				`{"function":"Refunds.Receive","signature":"func(context.Context, cloudevents.Event) error","types":["com.example.refund"],"source":"/billing"}]`,
+		},
+	}, {
+		name: "existing command package",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":  pkg,
+					"function": fn,
+					"protocol": proto,
+				},
+			}},
+		},
+		existing: true,
+		success:  false,
+	}, {
+		name: "template directory",
+		plan: packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":   pkg,
+					"function":  fn,
+					"signature": "func(context.Context, T) (*T, error)",
+					"in":        "context.Context,T",
+					"out":       "*T,error",
+					"payload":   "Order",
+					"result":    "Confirmation",
+					"protocol":  proto,
+				},
+			}},
+		},
+		templates: map[string]string{
+			"main.go.tmpl": "package main\n\n// Built by {{.Build.Buildpack}} {{.Build.BuildpackVersion}} against sdk-go {{.Build.SDKVersion}}.\n" +
+				"// {{.Function}} takes{{range .In}} {{.Kind}} {{.Type}}{{end}} (data version {{.Version}})\n",
+			"middleware.go.tmpl": "package main\n\nconst middleware = {{printf \"%q\" .Package}}\n",
+			"README.md":          "Not a template.",
+		},
+		success: true,
+		want: TemplateData{
+			Version:    TemplateDataVersion,
+			ModuleRoot: ".",
+			Package:    pkg,
+			Protocol:   proto,
+			Route: Route{
+				Function:  fn,
+				Signature: "func(context.Context, T) (*T, error)",
+				In: []Arg{
+					{Kind: "context", Type: "context.Context"},
+					{Kind: "payload", Type: "p.Order"},
+				},
+				Out: []Arg{
+					{Kind: "response", Pointer: true, Type: "*p.Confirmation"},
+					{Kind: "error", Type: "error"},
+				},
+				Payload: "Order",
+				Result:  "Confirmation",
+			},
+			Build: BuildInfo{
+				Buildpack:        "io.mattmoor.cloudevents.golang.functions",
+				BuildpackVersion: "1.2.3",
+				SDKVersion:       sdkVersion,
+			},
+		},
+		labels: map[string]string{
+			"io.cloudevents.function.package":        pkg,
+			"io.cloudevents.function.protocol":       proto,
+			"io.cloudevents.function.name":           fn,
+			"io.cloudevents.function.signature":      "func(context.Context, T) (*T, error)",
+			"io.cloudevents.function.sdk-go-version": sdkVersion,
+		},
 	}, {
 		name: "unsupported protocol",
 		plan: packit.BuildpackPlan{
@@ -80,16 +327,69 @@ func TestBuild(t *testing.T) {
 			b := Builder{
 				Logger: scribe.NewLogger(ioutil.Discard),
 			}
+			if test.templates != nil {
+				b.TemplateDir = "templates"
+			}
 			dir, err := ioutil.TempDir("", "")
 			if err != nil {
 				t.Fatal("TempDir() =", err)
 			}
 			defer os.RemoveAll(dir)
+			appDir, layersDir := filepath.Join(dir, "app"), filepath.Join(dir, "layers")
+			layerDir := filepath.Join(layersDir, "ce-go-function-cmd")
+
+			gomod := "module paketo.io\n\nrequire github.com/cloudevents/sdk-go/v2 " + sdkVersion + "\n"
+			if err := os.MkdirAll(appDir, os.ModePerm); err != nil {
+				t.Fatal("MkdirAll() =", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(appDir, "go.mod"), []byte(gomod), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			gosum := "github.com/cloudevents/sdk-go/v2 " + sdkVersion + " h1:QRTu0yRA4FbznjRSds0/4Hy6cVYpWV2wInlNJSHWAtw=\n"
+			if err := ioutil.WriteFile(filepath.Join(appDir, "go.sum"), []byte(gosum), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			// The function's source keeps the SDK's requirement.
+			fn := "package fn\n\nimport _ \"github.com/cloudevents/sdk-go/v2\"\n"
+			if err := os.MkdirAll(filepath.Join(appDir, "my-fn"), os.ModePerm); err != nil {
+				t.Fatal("MkdirAll() =", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(appDir, "my-fn", "fn.go"), []byte(fn), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			for name, content := range test.templates {
+				p := filepath.Join(appDir, "templates", name)
+				if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+					t.Fatal("MkdirAll() =", err)
+				}
+				if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+			if test.existing {
+				if err := os.MkdirAll(filepath.Join(appDir, targetPackage), os.ModePerm); err != nil {
+					t.Fatal("MkdirAll() =", err)
+				}
+			}
+
+			// Leave behind a longer file from a previous build, which must
+			// be replaced rather than overwritten in place.
+			stale := filepath.Join(layerDir, "main.go")
+			if err := os.MkdirAll(filepath.Dir(stale), os.ModePerm); err != nil {
+				t.Fatal("MkdirAll() =", err)
+			}
+			if err := ioutil.WriteFile(stale, bytes.Repeat([]byte("// stale\n"), 10000), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
 
 			bp, err := b.Build(packit.BuildContext{
-				WorkingDir: dir,
+				BuildpackInfo: packit.BuildpackInfo{
+					ID:      "io.mattmoor.cloudevents.golang.functions",
+					Version: "1.2.3",
+				},
+				WorkingDir: appDir,
 				Layers: packit.Layers{
-					Path: layersPath,
+					Path: layersDir,
 				},
 				Plan: test.plan,
 			})
@@ -102,23 +402,100 @@ func TestBuild(t *testing.T) {
 				return
 			}
 
-			// Check that the build plan matches what we want.
+			// Check that the build plan matches what we want.  The digest is
+			// checked by TestBuildReuse.
+			digest, _ := bp.Layers[0].Metadata[digestKey].(string)
+			if !strings.HasPrefix(digest, "sha256:") {
+				t.Errorf("digest = %q, wanted a sha256 digest", digest)
+			}
+			overlayPath := filepath.Join(layerDir, OverlayFile)
+			info := map[string]string{
+				"buildpack":             "io.mattmoor.cloudevents.golang.functions",
+				"buildpack-version":     "1.2.3",
+				"template-data-version": strconv.Itoa(TemplateDataVersion),
+			}
+			for k, v := range test.labels {
+				info[strings.TrimPrefix(k, labelPrefix)] = v
+			}
+			infoJSON, err := json.Marshal(info)
+			if err != nil {
+				t.Fatal("Marshal() =", err)
+			}
+			wantInfo := base64.RawURLEncoding.EncodeToString(infoJSON)
+			wantBuildPlan := packit.BuildResult{
+				Layers: []packit.Layer{{
+					Name:      "ce-go-function-cmd",
+					Path:      layerDir,
+					Build:     true,
+					Cache:     true,
+					SharedEnv: packit.Environment{},
+					BuildEnv: packit.Environment{
+						"BP_GO_TARGETS.override":     targetPackage,
+						"GOFLAGS.append":             "-tags=" + proto + " -overlay=" + overlayPath,
+						"GOFLAGS.delim":              " ",
+						"BP_GO_BUILD_LDFLAGS.append": "-X main.buildInfo=" + wantInfo,
+						"BP_GO_BUILD_LDFLAGS.delim":  " ",
+					},
+					LaunchEnv: packit.Environment{},
+					Metadata: map[string]interface{}{
+						digestKey: digest,
+					},
+				}},
+				Launch: packit.LaunchMetadata{
+					Processes: []packit.Process{{
+						Type:    "cloudevents-function",
+						Command: "function",
+						Direct:  true,
+					}},
+					Labels: test.labels,
+				},
+			}
 			if !cmp.Equal(bp, wantBuildPlan) {
 				t.Error("Build (-want, +got): ", cmp.Diff(wantBuildPlan, bp))
 			}
 
-			for _, file := range []string{"main", proto} {
+			// Check that the overlay places the generated files in the
+			// command package, which isn't written to the application.
+			gotOverlay, err := ReadOverlay(overlayPath)
+			if err != nil {
+				t.Fatal("ReadOverlay() =", err)
+			}
+			sources := map[string]string{
+				"main": templateSources["main"],
+				proto:  templateSources[proto],
+			}
+			for name, content := range test.templates {
+				if strings.HasSuffix(name, templateExt) {
+					sources[strings.TrimSuffix(name, templateExt)] = content
+				}
+			}
+			wantOverlay := Overlay{Replace: map[string]string{}}
+			for name := range sources {
+				wantOverlay.Replace[filepath.Join(appDir, targetPackage, name+".go")] = filepath.Join(layerDir, name+".go")
+			}
+			if !cmp.Equal(gotOverlay, wantOverlay) {
+				t.Error("overlay (-want, +got): ", cmp.Diff(wantOverlay, gotOverlay))
+			}
+			if _, err := os.Stat(filepath.Join(appDir, targetPackage)); !os.IsNotExist(err) {
+				t.Errorf("Stat() = %v, wanted the command package not to exist", err)
+			}
+
+			for file, text := range sources {
+				tmpl, err := parseTemplate(file, text)
+				if err != nil {
+					t.Fatalf("parseTemplate(%q) = %v", file, err)
+				}
 				buf := bytes.NewBuffer(nil)
-				if err := templates[file].Execute(buf, info{
-					Package:  pkg,
-					Function: fn,
-					Protocol: proto,
-				}); err != nil {
-					t.Fatalf("templates[%q].Execute() = %v", file, err)
+				if err := tmpl.Execute(buf, test.want); err != nil {
+					t.Fatalf("Execute(%q) = %v", file, err)
 				}
-				wantFileContents := buf.String()
+				want, err := format.Source(buf.Bytes())
+				if err != nil {
+					t.Fatalf("format.Source() = %v", err)
+				}
+				wantFileContents := string(want)
 
-				gotFileContents, err := ioutil.ReadFile(filepath.Join(dir, targetPackage, file+".go"))
+				gotFileContents, err := ioutil.ReadFile(filepath.Join(layerDir, file+".go"))
 				if err != nil {
 					t.Fatal("ReadFile() =", err)
 				}
@@ -130,3 +507,307 @@ func TestBuild(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildReuse(t *testing.T) {
+	dir := t.TempDir()
+	appDir, layersDir := filepath.Join(dir, "app"), filepath.Join(dir, "layers")
+	if err := os.MkdirAll(filepath.Join(appDir, "my-fn"), os.ModePerm); err != nil {
+		t.Fatal("MkdirAll() =", err)
+	}
+	const (
+		gomod = "module paketo.io\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n"
+		gosum = "github.com/cloudevents/sdk-go/v2 v2.3.1 h1:QRTu0yRA4FbznjRSds0/4Hy6cVYpWV2wInlNJSHWAtw=\n"
+		fn    = "package fn\n\nimport _ \"github.com/cloudevents/sdk-go/v2\"\n"
+	)
+	for name, content := range map[string]string{"go.mod": gomod, "go.sum": gosum, filepath.Join("my-fn", "fn.go"): fn} {
+		if err := ioutil.WriteFile(filepath.Join(appDir, name), []byte(content), 0644); err != nil {
+			t.Fatal("WriteFile() =", err)
+		}
+	}
+	plan := func(fn string) packit.BuildpackPlan {
+		return packit.BuildpackPlan{
+			Entries: []packit.BuildpackPlanEntry{{
+				Name: "ce-go-function",
+				Metadata: map[string]interface{}{
+					"package":  "paketo.io/my-fn",
+					"function": fn,
+					"protocol": "http",
+				},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		plan   packit.BuildpackPlan
+		before func(t *testing.T)
+		want   string
+	}{{
+		name: "first build",
+		plan: plan("MyHandler"),
+		want: "No cached scaffolding",
+	}, {
+		name: "unchanged",
+		plan: plan("MyHandler"),
+		want: "Reusing cached layer",
+	}, {
+		name: "other function",
+		plan: plan("OtherHandler"),
+		want: "The inputs changed",
+	}, {
+		name: "changed go.mod",
+		plan: plan("OtherHandler"),
+		before: func(t *testing.T) {
+			if err := ioutil.WriteFile(filepath.Join(appDir, "go.mod"), []byte(gomod+"\ngo 1.14\n"), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+		},
+		want: "The inputs changed",
+	}, {
+		name: "changed source",
+		plan: plan("OtherHandler"),
+		before: func(t *testing.T) {
+			if err := ioutil.WriteFile(filepath.Join(appDir, "my-fn", "fn.go"), []byte(fn+"\ntype OtherHandler struct{}\n"), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+		},
+		want: "The inputs changed",
+	}, {
+		name: "ignored source",
+		plan: plan("OtherHandler"),
+		before: func(t *testing.T) {
+			// Files excluded by the build constraints don't change the
+			// scaffolding.
+			if err := ioutil.WriteFile(filepath.Join(appDir, "my-fn", "fn_kafka.go"), []byte("//go:build kafka\n\n"+fn), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+		},
+		want: "Reusing cached layer",
+	}, {
+		name: "incomplete layer",
+		plan: plan("OtherHandler"),
+		before: func(t *testing.T) {
+			if err := os.Remove(filepath.Join(layersDir, "ce-go-function-cmd", OverlayFile)); err != nil {
+				t.Fatal("Remove() =", err)
+			}
+		},
+		want: "The cached scaffolding is incomplete",
+	}, {
+		name: "unchanged after regeneration",
+		plan: plan("OtherHandler"),
+		want: "Reusing cached layer",
+	}}
+
+	// The tests run in order, each building with the layer that the
+	// previous one left behind.
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.before != nil {
+				test.before(t)
+			}
+			var log bytes.Buffer
+			b := Builder{
+				Logger: scribe.NewLogger(&log),
+			}
+			bp, err := b.Build(packit.BuildContext{
+				WorkingDir: appDir,
+				Layers: packit.Layers{
+					Path: layersDir,
+				},
+				Plan: test.plan,
+			})
+			if err != nil {
+				t.Fatal("Build() =", err)
+			}
+			if !strings.Contains(log.String(), test.want) {
+				t.Errorf("Build() logged %q, wanted it to contain %q", log.String(), test.want)
+			}
+			if _, err := os.Stat(filepath.Join(layersDir, "ce-go-function-cmd", "main.go")); err != nil {
+				t.Error("Stat() =", err)
+			}
+
+			// Persist the layer's metadata, as the lifecycle would.
+			digest := bp.Layers[0].Metadata[digestKey].(string)
+			toml := fmt.Sprintf("build = true\ncache = true\n\n[metadata]\n  %s = %q\n", digestKey, digest)
+			if err := ioutil.WriteFile(filepath.Join(layersDir, "ce-go-function-cmd.toml"), []byte(toml), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+		})
+	}
+}
+
+func TestBuildWithoutGo(t *testing.T) {
+	// The go command is not on PATH when this buildpack runs before the Go
+	// buildpack.
+	t.Setenv("PATH", t.TempDir())
+
+	const (
+		gomod = "module paketo.io\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n"
+		gosum = "github.com/cloudevents/sdk-go/v2 v2.3.1 h1:QRTu0yRA4FbznjRSds0/4Hy6cVYpWV2wInlNJSHWAtw=\n"
+		fn    = "package fn\n\nimport _ \"github.com/cloudevents/sdk-go/v2\"\n"
+	)
+	tests := []struct {
+		name    string
+		check   string
+		want    string
+		wantErr string
+	}{{
+		name:  "checked",
+		check: "true",
+		want:  "Warning: the scaffolding is not type-checked, as the go command is not on PATH",
+	}, {
+		name:    "check required",
+		check:   "required",
+		wantErr: "CE_GO_CHECK_SCAFFOLDING=required needs the go command",
+	}, {
+		name:  "unchecked",
+		check: "false",
+	}, {
+		name:    "malformed",
+		check:   "yes",
+		wantErr: "CE_GO_CHECK_SCAFFOLDING must be true, false or required",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			appDir, layersDir := filepath.Join(dir, "app"), filepath.Join(dir, "layers")
+			if err := os.MkdirAll(appDir, os.ModePerm); err != nil {
+				t.Fatal("MkdirAll() =", err)
+			}
+			for name, content := range map[string]string{"go.mod": gomod, "go.sum": gosum, "fn.go": fn} {
+				if err := ioutil.WriteFile(filepath.Join(appDir, name), []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+
+			var log bytes.Buffer
+			b := Builder{
+				Logger: scribe.NewLogger(&log),
+				Check:  test.check,
+			}
+			_, err := b.Build(packit.BuildContext{
+				WorkingDir: appDir,
+				Layers: packit.Layers{
+					Path: layersDir,
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{{
+						Name: "ce-go-function",
+						Metadata: map[string]interface{}{
+							"package":  "paketo.io",
+							"function": "Receiver",
+							"protocol": "http",
+						},
+					}},
+				},
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Build() = %v, wanted an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Build() =", err)
+			}
+			if got := log.String(); test.want == "" && strings.Contains(got, "Warning") {
+				t.Errorf("Build() logged %q, wanted no warning", got)
+			} else if !strings.Contains(got, test.want) {
+				t.Errorf("Build() logged %q, wanted it to contain %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildTarget(t *testing.T) {
+	tests := []struct {
+		name  string
+		root  string
+		files map[string]string
+		want  string
+		err   string
+	}{{
+		name: "application directory",
+		root: ".",
+		want: "./ce-cmd/function",
+	}, {
+		name: "workspace uses the module",
+		root: "app",
+		files: map[string]string{
+			"go.work": "go 1.18\n\nuse ./app\n",
+		},
+		want: "./app/ce-cmd/function",
+	}, {
+		name: "workspace doesn't use the module",
+		root: "app",
+		files: map[string]string{
+			"go.work": "go 1.18\n\nuse ./other\n",
+		},
+		err: "use ./app",
+	}, {
+		name: "no workspace",
+		root: "app",
+		err:  "needs a go.work that uses the module in app",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+			got, err := buildTarget(dir, filepath.Join(dir, test.root), test.root)
+			switch {
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("buildTarget() = %v, wanted error containing %q", err, test.err)
+				}
+			case err != nil:
+				t.Error("buildTarget() =", err)
+			case got != test.want:
+				t.Errorf("buildTarget() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckGoRelease(t *testing.T) {
+	tests := []struct {
+		version string
+		err     string
+	}{{
+		version: "go version go1.16 linux/amd64",
+	}, {
+		version: "go version go1.18.3 darwin/arm64",
+	}, {
+		version: "go version go1.21rc2 linux/amd64",
+	}, {
+		version: "go version devel go1.22-d2f0ee3 Tue Aug 1 00:00:00 2023 +0000 linux/amd64",
+	}, {
+		version: "go version go1.15.15 linux/amd64",
+		err:     "requires Go 1.16 or later, but the build image has go version go1.15.15",
+	}, {
+		version: "go version go1.9 linux/amd64",
+		err:     "requires Go 1.16 or later",
+	}, {
+		version: "gccgo",
+		err:     "unable to find the Go release",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			err := checkGoRelease(test.version)
+			switch {
+			case test.err == "":
+				if err != nil {
+					t.Error("checkGoRelease() =", err)
+				}
+			case err == nil || !strings.Contains(err.Error(), test.err):
+				t.Errorf("checkGoRelease() = %v, wanted error containing %q", err, test.err)
+			}
+		})
+	}
+}
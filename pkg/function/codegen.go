@@ -0,0 +1,224 @@
+package function
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generatedFile is a file of the generated scaffolding.
+type generatedFile struct {
+	// Name is the name of the file, e.g. main.go.
+	Name string
+
+	// Template is the template that the file is rendered from.
+	Template source
+
+	// Source holds the formatted contents of the file.
+	Source []byte
+}
+
+// ScaffoldingError reports problems in the generated scaffolding, along with
+// the lines of the templates and adapters that produced them.
+type ScaffoldingError struct {
+	Problems []string
+}
+
+// Error implements error.
+func (e *ScaffoldingError) Error() string {
+	return "the generated scaffolding is invalid:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// generate renders the scaffolding for i from the templates, keyed by the
+// name of the file that each renders without its extension, and formats the
+// resulting files.  The main template and the protocol's are required.
+func generate(i *TemplateData, templates map[string]source) ([]generatedFile, error) {
+	var extra []string
+	for name := range templates {
+		if name != "main" && name != i.Protocol {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	var files []generatedFile
+	for _, name := range append([]string{"main", i.Protocol}, extra...) {
+		src, ok := templates[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported template: %q", name)
+		}
+		tmpl, err := parseTemplate(name, src.Text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, i); err != nil {
+			return nil, err
+		}
+
+		f := generatedFile{Name: name + ".go", Template: src}
+		formatted, err := format.Source(buf.Bytes())
+		if err != nil {
+			var list scanner.ErrorList
+			if !errors.As(err, &list) {
+				return nil, err
+			}
+			f.Source = buf.Bytes()
+			e := &ScaffoldingError{}
+			for _, se := range list {
+				se.Pos.Filename = f.Name
+				e.Problems = append(e.Problems, i.problem(f, se.Pos, se.Msg))
+			}
+			return nil, e
+		}
+		f.Source = formatted
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// checkGenerated type-checks the generated files against the user's package,
+// using the go command in moduleDir, the directory of the main module.
+func checkGenerated(moduleDir string, i *TemplateData, files []generatedFile) error {
+	fset := token.NewFileSet()
+	asts, err := parseGenerated(fset, files)
+	if err != nil {
+		return err
+	}
+	_, exports, err := listPackages(moduleDir, buildTags(i.Protocol), generatedImports(asts)...)
+	if err != nil {
+		return err
+	}
+	_, typeErrs := checkPackage("main", fset, asts, newImporter(fset, exports, nil))
+	if len(typeErrs) == 0 {
+		return nil
+	}
+
+	byName := make(map[string]generatedFile, len(files))
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	e := &ScaffoldingError{}
+	for _, err := range typeErrs {
+		var te types.Error
+		if !errors.As(err, &te) {
+			e.Problems = append(e.Problems, err.Error())
+			continue
+		}
+		pos := te.Fset.Position(te.Pos)
+		e.Problems = append(e.Problems, i.problem(byName[pos.Filename], pos, te.Msg))
+	}
+	return e
+}
+
+// parseGenerated parses the generated files.
+func parseGenerated(fset *token.FileSet, files []generatedFile) ([]*ast.File, error) {
+	asts := make([]*ast.File, 0, len(files))
+	for _, f := range files {
+		af, err := parser.ParseFile(fset, f.Name, f.Source, 0)
+		if err != nil {
+			return nil, err
+		}
+		asts = append(asts, af)
+	}
+	return asts, nil
+}
+
+// generatedImports returns the import paths of the packages that the parsed
+// files import, in order.
+func generatedImports(asts []*ast.File) []string {
+	seen := make(map[string]bool)
+	var imports []string
+	for _, af := range asts {
+		for _, imp := range af.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil && !seen[p] {
+				seen[p] = true
+				imports = append(imports, p)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// problem describes a problem at pos in the generated file f, along with the
+// line of the template or adapter that produced it.
+func (i *TemplateData) problem(f generatedFile, pos token.Position, msg string) string {
+	s := fmt.Sprintf("%s: %s", pos, msg)
+	lines := strings.Split(string(f.Source), "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return s
+	}
+	if origin := i.origin(f.Template, lines[pos.Line-1]); origin != "" {
+		s += "\n    generated by " + origin
+	}
+	return s
+}
+
+// source is the text of a template or an adapter.
+type source struct {
+	Name string
+	Text string
+}
+
+// origin finds the line of the template tmpl (or of the helpers or one of
+// the adapters) that produced the generated line, by matching the line
+// against the literal text of each line of the templates.  The line with the
+// most literal text wins.
+func (i *TemplateData) origin(tmpl source, line string) string {
+	sources := []source{tmpl, {
+		Name: "the template helpers",
+		Text: templateHelpers,
+	}}
+	for _, r := range i.all() {
+		sources = append(sources, source{
+			Name: fmt.Sprintf("the adapter of %s", r.Function),
+			Text: r.Adapter,
+		})
+	}
+
+	line = stripSpace(line)
+	var best string
+	most := 1
+	for _, src := range sources {
+		for n, tl := range strings.Split(src.Text, "\n") {
+			literal, re := templatePattern(tl)
+			if literal > most && re.MatchString(line) {
+				best = fmt.Sprintf("%s, line %d: %s", src.Name, n+1, strings.TrimSpace(tl))
+				most = literal
+			}
+		}
+	}
+	return best
+}
+
+// action matches the actions in a line of a template.
+var action = regexp.MustCompile(`{{.*?}}`)
+
+// templatePattern returns a pattern that matches the lines that the template
+// line tl may produce, ignoring white space, and the amount of literal text
+// in the line.
+func templatePattern(tl string) (int, *regexp.Regexp) {
+	parts := action.Split(stripSpace(tl), -1)
+	literal := 0
+	for i, part := range parts {
+		literal += len(part)
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return literal, regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// stripSpace removes the white space from s.
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
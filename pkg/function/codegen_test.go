@@ -0,0 +1,174 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	sigs, err := loadSignatures("../../buildpacks/signatures.json")
+	if err != nil {
+		t.Fatal("loadSignatures() =", err)
+	}
+	// The signatures of Handle and Sink in testdata/typed/payload.
+	var handle, sink signature
+	for _, sig := range sigs["http"] {
+		switch formatSignature(sig.FunctionSignature) {
+		case "func(context.Context, T) (*T, error)":
+			handle = sig
+		case "func(context.Context, T) error":
+			sink = sig
+		}
+	}
+
+	tests := []struct {
+		name      string
+		route     Route
+		templates map[string]source
+		wantErr   []string
+	}{{
+		name: "valid",
+		route: Route{
+			Function: "Handle",
+			Payload:  "Order",
+			Result:   "Confirmation",
+			Adapter:  handle.Adapter,
+			Imports:  handle.Imports,
+		},
+	}, {
+		name: "missing function",
+		route: Route{
+			Function: "Missing",
+			Payload:  "Order",
+			Adapter:  sink.Adapter,
+		},
+		wantErr: []string{
+			"main.go:",
+			"undefined: p.Missing",
+			fmt.Sprintf(`generated by template "main", line %d: fn := p.{{.Function}}`, templateLine("main", "fn := p.{{.Function}}")),
+		},
+	}, {
+		name: "wrong payload",
+		route: Route{
+			Function: "Sink",
+			Payload:  "Confirmation",
+			Adapter:  sink.Adapter,
+		},
+		wantErr: []string{
+			"cannot use data",
+			"generated by the adapter of Sink, line 5: return nil, fn(ctx, data)",
+		},
+	}, {
+		name: "malformed adapter",
+		route: Route{
+			Function: "Sink",
+			Payload:  "Order",
+			Adapter:  "return nil,, fn(ctx, data)",
+		},
+		wantErr: []string{
+			"generated by the adapter of Sink, line 1: return nil,, fn(ctx, data)",
+		},
+	}, {
+		name: "custom template",
+		route: Route{
+			Function: "Sink",
+			Payload:  "Order",
+			Adapter:  sink.Adapter,
+		},
+		templates: map[string]source{
+			"extra": {
+				Name: "templates/extra.go.tmpl",
+				Text: "package main\n\nvar name int = {{printf \"%q\" .Function}}\n",
+			},
+		},
+		wantErr: []string{
+			"extra.go:3:",
+			"generated by templates/extra.go.tmpl, line 3: var name int = {{printf \"%q\" .Function}}",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := &TemplateData{
+				ModuleRoot: ".",
+				Package:    "example.com/typed/payload",
+				Protocol:   "http",
+				Route:      test.route,
+			}
+			templates, err := loadTemplates("", "", "http")
+			if err != nil {
+				t.Fatal("loadTemplates() =", err)
+			}
+			for name, src := range test.templates {
+				templates[name] = src
+			}
+			files, err := generate(i, templates)
+			if err == nil {
+				err = checkGenerated("./testdata/typed", i, files)
+			}
+			if test.wantErr == nil {
+				if err != nil {
+					t.Fatal("Unexpected error:", err)
+				}
+				return
+			}
+
+			var se *ScaffoldingError
+			if !errors.As(err, &se) {
+				t.Fatalf("generate() = %v, wanted a ScaffoldingError", err)
+			}
+			for _, want := range test.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("generate() = %v, wanted it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	i := &TemplateData{
+		Route: Route{
+			Function: "Receiver",
+			Adapter:  "fn(event)\nreturn nil, nil",
+		},
+	}
+	tests := []struct {
+		line string
+		want string
+	}{{
+		line: "\tfn := p.Receiver",
+		want: fmt.Sprintf(`template "main", line %d: fn := p.{{.Function}}`, templateLine("main", "fn := p.{{.Function}}")),
+	}, {
+		line: "\t\treturn   nil, nil",
+		want: "the adapter of Receiver, line 2: return nil, nil",
+	}, {
+		line: "\t}",
+	}, {
+		line: "unrelated()",
+	}}
+
+	for _, test := range tests {
+		main := source{Name: `template "main"`, Text: templateSources["main"]}
+		if got := i.origin(main, test.line); got != test.want {
+			t.Errorf("origin(%q) = %q, wanted %q", test.line, got, test.want)
+		}
+	}
+}
+
+// templateLine returns the number of the first line of the template that
+// contains text.
+func templateLine(tmpl, text string) int {
+	for n, line := range strings.Split(templateSources[tmpl], "\n") {
+		if strings.Contains(line, text) {
+			return n + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,248 @@
+package function
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateDataVersion is the version of TemplateData.  It is incremented
+// whenever fields or methods are removed or change meaning, so that
+// templates can check that they understand the data.
+const TemplateDataVersion = 1
+
+// TemplateData is the data that the scaffolding templates are executed with,
+// including those supplied through CE_TEMPLATE_DIR.
+type TemplateData struct {
+	// Version is TemplateDataVersion.
+	Version int
+
+	// ModuleRoot is the directory of the main module, relative to the
+	// application directory.
+	ModuleRoot string
+
+	// Package is the import path of the function's package, which the
+	// scaffolding imports as p.  Protocol is the protocol of the events.
+	Package  string
+	Protocol string
+
+	// Path holds the HTTP path on which events are received, if not "/".
+	Path string
+
+	// Route describes the function, when a single function is wrapped.
+	Route
+
+	// Routes holds the functions that events are routed to, in order, when
+	// several functions are wrapped.
+	Routes []Route
+
+	// Build describes the build that produced the scaffolding.
+	Build BuildInfo
+}
+
+// BuildInfo describes the build that produced the scaffolding.
+type BuildInfo struct {
+	// Buildpack and BuildpackVersion identify this buildpack.
+	Buildpack        string
+	BuildpackVersion string
+
+	// SDKVersion is the version of the CloudEvents SDK that the main module
+	// requires, as for the sdk-go-version label.
+	SDKVersion string
+}
+
+// Arg describes a parameter or result of a function.
+type Arg struct {
+	// Kind is one of "context", "event", "payload" (the struct that the
+	// event's data is decoded into), "response" (the struct that is encoded
+	// into the data of the response event), "result" (a protocol.Result),
+	// "error" or "other".
+	Kind string
+
+	// Pointer is set when the argument is a pointer.
+	Pointer bool
+
+	// Type is the argument's type as it is written in the scaffolding,
+	// e.g. "*cloudevents.Event" or "p.Order".
+	Type string
+}
+
+// Route describes a function and the events that are passed to it.
+type Route struct {
+	// Function is the name of the function, and Signature is the supported
+	// signature that it matches.
+	Function  string
+	Signature string
+
+	// In and Out describe the parameters and results of the function.
+	In  []Arg
+	Out []Arg
+
+	// Constructor is set when Function names a method (Type.Method), and
+	// holds the function that constructs the receiver.  Method holds the
+	// name of the method.
+	Constructor string
+	Method      string
+
+	// Payload is set when Function takes the event's data decoded into a
+	// struct, and holds the name of that type.  Result holds the name of
+	// the struct that is encoded into the response event, if any.
+	Payload string
+	Result  string
+
+	// Native is set when the CloudEvents client accepts the function as it
+	// is.  Adapter holds the scaffolding that adapts it otherwise, which
+	// uses the packages in Imports.
+	Native  bool
+	Adapter string
+	Imports []string
+
+	// Types holds the patterns of the event types that the function
+	// accepts, or nil to accept all events.  Source holds the source of
+	// the events that the function accepts, or "" to accept any source.
+	Types  []string
+	Source string
+}
+
+// Call returns the body of the function that adapts the user's function to
+// a CloudEvents receiver, indented to fit the scaffolding.
+func (r Route) Call() (string, error) {
+	tmpl, err := template.New("adapter").Parse(r.Adapter)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, r); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		b.WriteString("\n")
+		if line != "" {
+			b.WriteString("\t\t" + line)
+		}
+	}
+	return b.String(), nil
+}
+
+// Filtered returns whether the function only accepts some events.
+func (r Route) Filtered() bool {
+	return len(r.Types) > 0 || r.Source != ""
+}
+
+// Adapted returns whether the scaffolding adapts the function before passing
+// it to the CloudEvents client, rather than passing it as is.
+func (r Route) Adapted() bool {
+	return !r.Native || r.Filtered()
+}
+
+// Receiver returns the name of the variable that holds the receiver of the
+// method, when several functions are wrapped.
+func (r Route) Receiver() string {
+	return "receiver" + strings.TrimPrefix(r.Constructor, "New")
+}
+
+// all returns the wrapped functions.
+func (i TemplateData) all() []Route {
+	if len(i.Routes) > 0 {
+		return i.Routes
+	}
+	return []Route{i.Route}
+}
+
+// Filters returns whether any of the functions only accepts some events.
+func (i TemplateData) Filters() bool {
+	for _, r := range i.all() {
+		if r.Filtered() {
+			return true
+		}
+	}
+	return false
+}
+
+// mainImports holds the packages that the scaffolding imports regardless of
+// the adapters.
+var mainImports = map[string]bool{
+	"context":                          true,
+	"encoding/base64":                  true,
+	"encoding/json":                    true,
+	"log":                              true,
+	"net/http":                         true,
+	"os":                               true,
+	"os/signal":                        true,
+	"path":                             true,
+	"syscall":                          true,
+	"time":                             true,
+	"github.com/cloudevents/sdk-go/v2": true,
+	"github.com/cloudevents/sdk-go/v2/protocol": true,
+}
+
+// Imports returns the additional packages that the adapters of the functions
+// import, in order.
+func (i TemplateData) Imports() []string {
+	var imports []string
+	seen := make(map[string]bool)
+	for _, r := range i.all() {
+		if !r.Adapted() {
+			continue
+		}
+		for _, imp := range r.Imports {
+			if !mainImports[imp] && !seen[imp] {
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// Constructors returns the routes of the methods whose receivers need to be
+// constructed, one for each constructor.
+func (i TemplateData) Constructors() []Route {
+	var ctors []Route
+	seen := make(map[string]bool)
+	for _, r := range i.Routes {
+		if r.Constructor != "" && !seen[r.Constructor] {
+			seen[r.Constructor] = true
+			ctors = append(ctors, r)
+		}
+	}
+	return ctors
+}
+
+// argKinds maps the arguments of the supported signatures, as they are
+// written in source, to their kinds.
+var argKinds = map[string]string{
+	"context.Context":    "context",
+	"cloudevents.Event":  "event",
+	"T":                  "payload",
+	"protocol.Result":    "result",
+	"cloudevents.Result": "result",
+	"error":              "error",
+}
+
+// parseArgs describes the arguments in list, as they are written in source,
+// where T stands for the user type named typ.  The list holds results when
+// out is set, where T is the response rather than the payload.
+func parseArgs(list []string, typ string, out bool) []Arg {
+	var args []Arg
+	for _, s := range list {
+		arg := Arg{Type: s}
+		name := strings.TrimPrefix(s, "*")
+		arg.Pointer = name != s
+		arg.Kind = argKinds[name]
+		switch {
+		case arg.Kind == "":
+			arg.Kind = "other"
+		case arg.Kind == "payload":
+			arg.Type = strings.TrimSuffix(s, name) + "p." + typ
+			if out {
+				arg.Kind = "response"
+			}
+		}
+		args = append(args, arg)
+	}
+	return args
+}
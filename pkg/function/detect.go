@@ -1,12 +1,22 @@
 package function
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/paketo-buildpacks/packit"
@@ -17,171 +27,156 @@ import (
 // the detect phase of a Paketo buildpack.  It is expected to be initialized
 // from the environment via Kelsey's envconfig library.
 type Detector struct {
+	// ModuleRoot holds the directory containing the go.mod of the main
+	// module, relative to the application directory.  The scaffolding is
+	// generated into this module.
+	ModuleRoot string `envconfig:"CE_GO_MODULE_ROOT" default:"."`
+
 	// Package holds the name of the user-configured Go package containing
-	// a CloudEvents function.
+	// a CloudEvents function, relative to ModuleRoot.
 	Package string `envconfig:"CE_GO_PACKAGE" default:"."`
 
 	// Function holds the name of the CloudEvent receiver in Package that this
-	// buildpack should wrap in CloudEvents scaffolding.
-	Function string `envconfig:"CE_GO_FUNCTION" default:"Receiver"`
+	// buildpack should wrap in CloudEvents scaffolding.  It may also name a
+	// method as Type.Method, in which case the receiver is constructed by a
+	// function named NewType, which takes a context.Context and returns the
+	// receiver and an error.
+	// When it is not set, the function is selected automatically from the
+	// exported functions in Package with a supported signature.
+	Function string `envconfig:"CE_GO_FUNCTION"`
+
+	// Functions holds a space-separated list of the functions in Package
+	// to which events are routed, instead of Function.  Each entry takes the
+	// form Function=types@source, where types is a comma-separated list of
+	// event types that may contain wildcards, and the source is optional.
+	// Entries of just Function take the types and source from the function's
+	// directive.  Events are routed to the first function that accepts them.
+	// When neither Function nor Functions are set, and several functions have
+	// directives that select their event types, events are routed to them.
+	Functions string `envconfig:"CE_GO_FUNCTIONS"`
 
 	// Protocol holds the name of the protocol to which we will
-	// bind the receiver function.
-	Protocol string `envconfig:"CE_PROTOCOL" default:"http"`
+	// bind the receiver function.  When it is not set, the protocol
+	// comes from the function's directive, or defaults to "http".
+	Protocol string `envconfig:"CE_PROTOCOL"`
+
+	// Path holds the HTTP path on which events are received, overriding
+	// the function's directive.
+	Path string `envconfig:"CE_PATH"`
+
+	// Types holds a comma-separated list of the event types that the
+	// function accepts, which may contain wildcards, overriding the
+	// function's directive.  By default, all event types are accepted.
+	Types string `envconfig:"CE_TYPES"`
+
+	// Mode holds how function signatures are detected.  The "syntax" mode
+	// matches the types as they are written in the source, whereas the
+	// "types" mode type-checks the package, which requires the go command.
+	// Without it, as when detecting in a buildpack build, detection falls
+	// back to the "syntax" mode.
+	Mode string `envconfig:"CE_GO_DETECT_MODE" default:"syntax"`
+
+	// ReportFile holds the path of a file to which a JSON Report is written
+	// when detection fails because no function matches a supported
+	// signature, for other tooling to consume.
+	ReportFile string `envconfig:"CE_DETECT_REPORT"`
+
+	// SignaturesFile holds the path of a JSON file with signatures to
+	// support in addition to those shipped in the buildpack, relative to
+	// the application directory.  It maps protocol names to lists of
+	// signatures, each of which comes with the scaffolding that adapts it
+	// to a CloudEvents receiver.  These take precedence over the shipped
+	// signatures.
+	SignaturesFile string `envconfig:"CE_SIGNATURES_FILE"`
 }
 
-var (
-	detectors = map[string]*detect.Detector{
-		"http": detect.NewDetector([]detect.FunctionSignature{{
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2/protocol",
-				Name:       "Result",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				Name: "error",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2/protocol",
-				Name:       "Result",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				Name: "error",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2/protocol",
-				Name:       "Result",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}, {
-				Name: "error",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2/protocol",
-				Name:       "Result",
-			}},
-		}, {
-			In: []detect.FunctionArg{{
-				ImportPath: "context",
-				Name:       "Context",
-			}, {
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-			}},
-			Out: []detect.FunctionArg{{
-				ImportPath: "github.com/cloudevents/sdk-go/v2",
-				Name:       "Event",
-				Pointer:    true,
-			}, {
-				Name: "error",
-			}},
-		}}),
-	}
-)
+// defaultProtocol is the protocol used when neither Protocol nor the
+// function's directive select one.
+const defaultProtocol = "http"
 
 // Detect is a member function that implements packit.DetectFunc
 func (d *Detector) Detect(dctx packit.DetectContext) (packit.DetectResult, error) {
-	moduleName, err := readModuleName(dctx)
+	result, err := d.detect(dctx)
+	var report *Report
+	if d.ReportFile != "" && errors.As(err, &report) {
+		if err := writeReport(d.ReportFile, report); err != nil {
+			log.Printf("Unable to write detection report: %v", err)
+		}
+	}
+	return result, err
+}
+
+// writeReport writes the report to the file p as JSON.
+func writeReport(p string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, append(data, '\n'), 0644)
+}
+
+func (d *Detector) detect(dctx packit.DetectContext) (packit.DetectResult, error) {
+	pkg, err := resolvePackage(dctx.WorkingDir, d.ModuleRoot, d.Package)
+	if err != nil {
+		return packit.DetectResult{}, err
+	}
+	specs, err := d.routeSpecs()
 	if err != nil {
 		return packit.DetectResult{}, err
 	}
-	pkg := filepath.Join(moduleName, d.Package)
-	fn := d.Function
 
-	if detector, ok := detectors[d.Protocol]; !ok {
-		return packit.DetectResult{}, fmt.Errorf("unsupported protocol: %q", d.Protocol)
-	} else if err := d.checkFunction(dctx, pkg, fn, detector); err != nil {
+	// The functions' directives configure them, unless the environment
+	// overrides their settings.  The protocol selects the signatures and
+	// build tags that the functions are found with, so it comes first.
+	protocol := d.Protocol
+	if protocol == "" {
+		if protocol, err = d.directiveProtocol(dctx, specs); err != nil {
+			return packit.DetectResult{}, err
+		}
+	}
+	fns, err := d.checkFunctions(dctx, pkg, specs, protocol)
+	if err != nil {
 		return packit.DetectResult{}, err
 	}
+	path, err := directiveSetting(fns, "path")
+	if err != nil {
+		return packit.DetectResult{}, err
+	}
+
+	metadata := map[string]interface{}{
+		"module-root": d.ModuleRoot,
+		"package":     pkg,
+		"protocol":    protocol,
+	}
+	if path := override(d.Path, path); path != "" {
+		metadata["path"] = path
+	}
+
+	routes := make([]map[string]interface{}, 0, len(fns))
+	for i, fn := range fns {
+		var spec routeSpec
+		if i < len(specs) {
+			spec = specs[i]
+		}
+		types := override(spec.Types, fn.Directive["types"])
+		source := override(spec.Source, fn.Directive["source"])
+		if len(fns) == 1 {
+			types = override(d.Types, types)
+		} else if types == "" {
+			return packit.DetectResult{}, fmt.Errorf("function %q has no event types to route to it", fn.Name)
+		}
+		routes = append(routes, fn.metadata(types, source))
+	}
+	if len(routes) == 1 {
+		for k, v := range routes[0] {
+			metadata[k] = v
+		}
+	} else {
+		if d.Types != "" {
+			return packit.DetectResult{}, errors.New("CE_TYPES applies to a single function, set the types of each function in CE_GO_FUNCTIONS instead")
+		}
+		metadata["routes"] = routes
+	}
 
 	return packit.DetectResult{
 		Plan: packit.BuildPlan{
@@ -189,69 +184,604 @@ func (d *Detector) Detect(dctx packit.DetectContext) (packit.DetectResult, error
 				Name: "ce-go-function",
 			}},
 			Requires: []packit.BuildPlanRequirement{{
-				Name: "ce-go-function",
-				Metadata: map[string]interface{}{
-					"package":  pkg,
-					"function": fn,
-					"protocol": d.Protocol,
-				},
+				Name:     "ce-go-function",
+				Metadata: metadata,
 			}},
 		},
 	}, nil
 }
 
-func (d *Detector) checkFunction(dctx packit.DetectContext, pkg, fn string, detector *detect.Detector) error {
-	// read all go files from the directory that was given. Note that if no directory (CE_GO_PACKAGE)
-	// was given, this is ./
-	files, err := filepath.Glob(filepath.Join(dctx.WorkingDir, d.Package, "*.go"))
+// override returns value, unless it is overridden by a non-empty env.
+func override(env, value string) string {
+	if env != "" {
+		return env
+	}
+	return value
+}
+
+// routeSpec describes a function that events are routed to, as configured
+// through the environment.
+type routeSpec struct {
+	Function string
+
+	// Types and Source select the events routed to the function.  When
+	// they are empty, they come from the function's directive.
+	Types  string
+	Source string
+}
+
+// routeSpecs returns the functions configured through Function or Functions,
+// or nil when they should be selected automatically.
+func (d *Detector) routeSpecs() ([]routeSpec, error) {
+	if d.Functions == "" {
+		if d.Function == "" {
+			return nil, nil
+		}
+		return []routeSpec{{Function: d.Function}}, nil
+	} else if d.Function != "" {
+		return nil, errors.New("CE_GO_FUNCTION and CE_GO_FUNCTIONS cannot both be set")
+	}
+
+	var specs []routeSpec
+	seen := make(map[string]bool)
+	for _, entry := range strings.Fields(d.Functions) {
+		spec := routeSpec{Function: entry}
+		if i := strings.Index(entry, "="); i >= 0 {
+			spec.Function, spec.Types = entry[:i], entry[i+1:]
+			if j := strings.Index(spec.Types, "@"); j >= 0 {
+				spec.Types, spec.Source = spec.Types[:j], spec.Types[j+1:]
+			}
+			if spec.Types == "" {
+				return nil, fmt.Errorf("malformed CE_GO_FUNCTIONS entry %q, expected Function=types[@source]", entry)
+			}
+		}
+		if spec.Function == "" {
+			return nil, fmt.Errorf("malformed CE_GO_FUNCTIONS entry %q, expected Function=types[@source]", entry)
+		} else if seen[spec.Function] {
+			return nil, fmt.Errorf("function %q appears more than once in CE_GO_FUNCTIONS", spec.Function)
+		}
+		seen[spec.Function] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// directiveSetting returns the value of the given setting in the directives
+// of fns, which must agree when several of them set it.
+func directiveSetting(fns []candidate, key string) (string, error) {
+	var value, from string
+	for _, fn := range fns {
+		v := fn.Directive[key]
+		if v == "" {
+			continue
+		} else if value != "" && v != value {
+			return "", fmt.Errorf("functions %q and %q have conflicting %s settings: %q and %q", from, fn.Name, key, value, v)
+		}
+		value, from = v, fn.Name
+	}
+	return value, nil
+}
+
+// directiveProtocol returns the protocol that the directives of the
+// functions in specs select, or of any function when specs is empty, or the
+// default protocol when they select none.  The directives are looked up in
+// the files that each protocol's build compiles, so that a directive only
+// counts when go build would compile its function with the protocol it
+// selects, as with a file tagged for that protocol.
+func (d *Detector) directiveProtocol(dctx packit.DetectContext, specs []routeSpec) (string, error) {
+	protocols, err := d.signatures(dctx.CNBPath, dctx.WorkingDir)
 	if err != nil {
-		return err
+		return "", err
+	}
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	selected := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		selected[spec.Function] = true
 	}
 
-	for _, f := range files {
-		srcbuf, err := ioutil.ReadFile(f)
+	dir := filepath.Join(dctx.WorkingDir, d.ModuleRoot, d.Package)
+	var fns []candidate
+	for _, protocol := range names {
+		directives, err := findDirectives(dir, buildTags(protocol))
 		if err != nil {
-			return err
+			return "", err
+		}
+		fnNames := make([]string, 0, len(directives))
+		for name := range directives {
+			fnNames = append(fnNames, name)
+		}
+		sort.Strings(fnNames)
+		for _, name := range fnNames {
+			if len(specs) > 0 && !selected[name] {
+				continue
+			}
+			p := directives[name]["protocol"]
+			// Directives that select an unsupported protocol are kept,
+			// so that checkFunctions reports it.
+			if _, ok := protocols[p]; p == protocol || (p != "" && !ok) {
+				fns = append(fns, candidate{Name: name, Directive: directives[name]})
+			}
+		}
+	}
+	protocol, err := directiveSetting(fns, "protocol")
+	if err != nil || protocol != "" {
+		return protocol, err
+	}
+	return defaultProtocol, nil
+}
+
+// candidate describes an exported function in the user's package whose
+// signature matches one of the supported signatures for a protocol.
+type candidate struct {
+	// Name is the name of the function, or Type.Method for methods.
+	// Signature is the supported signature that it matches, as written in
+	// source.
+	Name      string
+	Signature string
+
+	// In and Out hold the parameters and results of the signature, as
+	// written in source.
+	In  []string
+	Out []string
+
+	// binding holds the user types that the event data is decoded into,
+	// and that the response data is encoded from, if any.
+	binding
+
+	// Native, Imports and Adapter come from the matched signature.
+	Native  bool
+	Imports []string
+	Adapter string
+
+	// Constructor is the name of the function that constructs the receiver
+	// of a method, which is called with the startup context.
+	Constructor string
+
+	// Directive holds the settings of the function's directive comment.
+	Directive directive
+
+	// Err is set instead of Signature when the function's signature
+	// does not match, or a method is missing its constructor.
+	Err error
+}
+
+// matched records that the candidate matches the signature sig, with the
+// user types in b.
+func (c *candidate) matched(sig *signature, b binding) {
+	c.Signature = formatSignature(sig.FunctionSignature)
+	c.In, c.Out = formatArgs(sig.In), formatArgs(sig.Out)
+	c.binding = b
+	c.Native, c.Imports, c.Adapter = sig.Native, sig.Imports, sig.Adapter
+}
+
+// metadata returns the plan metadata that describes the function, and the
+// event types and source that are routed to it.
+func (c *candidate) metadata(types, source string) map[string]interface{} {
+	md := map[string]interface{}{
+		"function":  c.Name,
+		"signature": c.Signature,
+		"adapter":   c.Adapter,
+	}
+	if len(c.In) > 0 {
+		md["in"] = strings.Join(c.In, ",")
+	}
+	if len(c.Out) > 0 {
+		md["out"] = strings.Join(c.Out, ",")
+	}
+	if c.Native {
+		md["native"] = true
+	}
+	if len(c.Imports) > 0 {
+		md["imports"] = strings.Join(c.Imports, ",")
+	}
+	if c.Constructor != "" {
+		md["constructor"] = c.Constructor
+	}
+	if c.Payload != "" {
+		md["payload"] = c.Payload
+	}
+	if c.Result != "" {
+		md["result"] = c.Result
+	}
+	if types != "" {
+		md["types"] = types
+	}
+	if source != "" {
+		md["source"] = source
+	}
+	return md
+}
+
+// finders holds the ways to find the candidate functions in a package,
+// keyed by detection mode.
+var finders = map[string]func(dir string, tags []string, sigs []signature) ([]candidate, error){
+	"syntax": findCandidates,
+	"types":  findTypedCandidates,
+}
+
+// checkFunctions returns the functions in pkg that the scaffolding wraps for
+// the given protocol: those in specs, or the ones selected automatically when
+// specs is empty.
+func (d *Detector) checkFunctions(dctx packit.DetectContext, pkg string, specs []routeSpec, protocol string) ([]candidate, error) {
+	protocols, err := d.signatures(dctx.CNBPath, dctx.WorkingDir)
+	if err != nil {
+		return nil, err
+	}
+	sigs, ok := protocols[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol: %q", protocol)
+	}
+	mode := d.Mode
+	if mode == "" {
+		mode = "syntax"
+	}
+	find, ok := finders[mode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported detection mode: %q", d.Mode)
+	}
+	if mode == "types" {
+		// The go command is only installed by the Go buildpack, which
+		// runs after detection in a buildpack build.
+		if _, err := exec.LookPath("go"); err != nil {
+			log.Printf("CE_GO_DETECT_MODE=types requires the go command, which is not on PATH, so falling back to the syntax mode")
+			find = finders["syntax"]
+		}
+	}
+	dir := filepath.Join(dctx.WorkingDir, d.ModuleRoot, d.Package)
+	tags := buildTags(protocol)
+	found, err := find(dir, tags, sigs)
+	if err != nil {
+		return nil, err
+	}
+	directives, err := findDirectives(dir, tags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		found[i].Directive = directives[found[i].Name]
+	}
+
+	// When the functions have been explicitly configured, they must be
+	// among the candidates we found.
+	if len(specs) > 0 {
+		fns := make([]candidate, 0, len(specs))
+		for _, spec := range specs {
+			c, err := lookupFunction(found, pkg, spec.Function, protocol)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, *c)
+		}
+		return fns, nil
+	}
+
+	candidates := make([]candidate, 0, len(found))
+	for _, c := range found {
+		if c.Err == nil {
+			candidates = append(candidates, c)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		// Report the functions that came close to matching.
+		report := &Report{
+			Package:  pkg,
+			Protocol: protocol,
+		}
+		for _, c := range found {
+			var diag *Diagnostic
+			if errors.As(c.Err, &diag) && diag.nearMiss() {
+				report.Diagnostics = append(report.Diagnostics, diag)
+			}
+		}
+		if len(report.Diagnostics) > 0 {
+			return nil, report
+		}
+		return nil, fmt.Errorf("unable to find a function in %q with matching signature", pkg)
+	case 1:
+		log.Printf("Selected function %q in package %q signature %q", candidates[0].Name, pkg, candidates[0].Signature)
+		return candidates, nil
+	}
+
+	// Prefer the functions that carry a directive.  When several of them
+	// do, and each selects the event types it handles, route events to all
+	// of them.
+	var directed []candidate
+	routable := true
+	for _, c := range candidates {
+		if c.Directive != nil {
+			directed = append(directed, c)
+			routable = routable && c.Directive["types"] != ""
+		}
+	}
+	if len(directed) == 1 || (len(directed) > 1 && routable) {
+		for _, c := range directed {
+			log.Printf("Selected function %q in package %q signature %q", c.Name, pkg, c.Signature)
+		}
+		return directed, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "found multiple functions in %q with matching signatures:\n", pkg)
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "  %s: %s\n", c.Name, c.Signature)
+	}
+	fmt.Fprintf(&b, "select one by adding the following to project.toml:\n\n")
+	fmt.Fprintf(&b, "[[build.env]]\nname = \"CE_GO_FUNCTION\"\nvalue = %q\n", candidates[0].Name)
+	return nil, errors.New(b.String())
+}
+
+// lookupFunction returns the candidate named fn, or an error if it is missing
+// or doesn't match.
+func lookupFunction(found []candidate, pkg, fn, protocol string) (*candidate, error) {
+	for i, c := range found {
+		if c.Name != fn {
+			continue
+		}
+		var diag *Diagnostic
+		if errors.As(c.Err, &diag) {
+			return nil, &Report{
+				Package:     pkg,
+				Protocol:    protocol,
+				Function:    fn,
+				Diagnostics: []*Diagnostic{diag},
+			}
+		} else if c.Err != nil {
+			return nil, c.Err
 		}
+		return &found[i], nil
+	}
+	return nil, fmt.Errorf("unable to find function %q in %q with matching signature", fn, pkg)
+}
 
-		deets, err := detector.CheckFile(&detect.Function{
-			File:   f,
-			Source: string(srcbuf),
-		})
+// buildTags returns the build tags that the build phase compiles the user's
+// package with: the protocol tag that we add to GOFLAGS, and any tags the user
+// passes to the Go buildpack through BP_GO_BUILD_FLAGS.
+func buildTags(protocol string) []string {
+	tags := []string{protocol}
+	fields := strings.Fields(os.Getenv("BP_GO_BUILD_FLAGS"))
+	for i, f := range fields {
+		var value string
+		switch {
+		case f == "-tags" || f == "--tags":
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+		case strings.HasPrefix(f, "-tags="):
+			value = strings.TrimPrefix(f, "-tags=")
+		case strings.HasPrefix(f, "--tags="):
+			value = strings.TrimPrefix(f, "--tags=")
+		default:
+			continue
+		}
+		for _, tag := range strings.Split(strings.Trim(value, `"'`), ",") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// findCandidates parses the Go files in dir and returns the exported,
+// top-level functions and the exported methods of exported types, sorted by
+// name.  Those whose signatures match one of sigs have their Signature set.
+// The others carry an error explaining why they don't match.
+func findCandidates(dir string, tags []string, sigs []signature) ([]candidate, error) {
+	// Only consider the files that go build would compile with these tags,
+	// which excludes tests and files for other platforms.
+	files, err := buildFiles(dir, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Methods are matched after all of the files have been parsed, so that we
+	// can find their constructors.
+	type decl struct {
+		imports map[string]string
+		fd      *ast.FuncDecl
+	}
+	funcs := make(map[string]decl)
+	var methods []decl
+
+	fset := token.NewFileSet()
+	astFiles := make([]*ast.File, 0, len(files))
+	for _, f := range files {
+		astFile, err := parser.ParseFile(fset, f, nil, 0)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		astFiles = append(astFiles, astFile)
+	}
+	structs := structTypes(astFiles)
+
+	var candidates []candidate
+	for _, astFile := range astFiles {
+		imports := localImports(astFile)
+
+		for _, d := range astFile.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || !fd.Name.IsExported() {
+				continue
+			}
+			if fd.Recv != nil {
+				methods = append(methods, decl{imports: imports, fd: fd})
+				continue
+			}
+			funcs[fd.Name.Name] = decl{imports: imports, fd: fd}
+			c := candidate{Name: fd.Name.Name}
+			if sig, b := matchSignature(imports, structs, fd.Type, sigs); sig != nil {
+				c.matched(sig, b)
+			} else {
+				c.Err = diagnoseSource(fset, c.Name, fd, imports, structs, sigs)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	for _, m := range methods {
+		typeName, pointer := receiverType(m.fd)
+		if !ast.IsExported(typeName) {
+			continue
+		}
+		c := candidate{
+			Name:        typeName + "." + m.fd.Name.Name,
+			Constructor: constructorName(typeName),
 		}
-		if deets == nil {
+		sig, b := matchSignature(m.imports, structs, m.fd.Type, sigs)
+		if sig == nil {
+			c.Err = diagnoseSource(fset, c.Name, m.fd, m.imports, structs, sigs)
+			candidates = append(candidates, c)
 			continue
 		}
+		c.matched(sig, b)
+		if ctor, ok := funcs[c.Constructor]; !ok || !isConstructor(ctor.imports, ctor.fd.Type, typeName, pointer) {
+			c.Signature, c.Err = "", constructorError(c.Name, typeName)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates, nil
+}
 
-		if deets.Name != fn {
-			// TODO(mattmoor): Add help text to tell the user how to properly configure project.toml,
-			// or make the defaulting smart when it is not explicitly specified.
-			log.Printf("Found supported function %q in package %q signature %q", deets.Name, deets.Package, deets.Signature)
+// buildFiles returns the paths of the Go files in dir that go build would
+// compile with the given build tags.
+func buildFiles(dir string, tags []string) ([]string, error) {
+	bctx := build.Default
+	bctx.BuildTags = tags
+	bp, err := bctx.ImportDir(dir, 0)
+	var noGo *build.NoGoError
+	if errors.As(err, &noGo) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(bp.GoFiles)+len(bp.CgoFiles))
+	for _, name := range append(bp.GoFiles, bp.CgoFiles...) {
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+// localImports maps the local names of the file's imports to their
+// full import paths, e.g. nethttp "net/http" maps "nethttp" to "net/http".
+func localImports(f *ast.File) map[string]string {
+	imports := make(map[string]string, len(f.Imports))
+	for _, i := range f.Imports {
+		impPath, err := strconv.Unquote(i.Path.Value)
+		if err != nil {
 			continue
 		}
+		if i.Name != nil {
+			imports[i.Name.Name] = impPath
+		} else {
+			imports[path.Base(impPath)] = impPath
+		}
+	}
+	return imports
+}
+
+// matchSignature returns the first signature in sigs that matches ft, or nil
+// if none of them match, along with the user types bound to the signature's
+// placeholders.  structs holds the exported struct types declared in the
+// package.
+func matchSignature(imports map[string]string, structs map[string]bool, ft *ast.FuncType, sigs []signature) (*signature, binding) {
+	in := fieldArgs(imports, ft.Params)
+	out := fieldArgs(imports, ft.Results)
+	for i, sig := range sigs {
+		var b binding
+		if b.bindArgs(in, sig.In, structs) && b.bindArgs(out, sig.Out, structs) {
+			return &sigs[i], b
+		}
+	}
+	return nil, binding{}
+}
+
+// diagnoseSource explains why the function fd, which is called name, doesn't
+// match any of sigs.
+func diagnoseSource(fset *token.FileSet, name string, fd *ast.FuncDecl, imports map[string]string, structs map[string]bool, sigs []signature) *Diagnostic {
+	return diagnose(name, fset.Position(fd.Name.Pos()).String(), types.ExprString(fd.Type),
+		sourceArgs(imports, structs, fd.Type.Params), sourceArgs(imports, structs, fd.Type.Results), sigs)
+}
+
+// sourceArgs describes the arguments in fl, as written in source, for
+// diagnostics.
+func sourceArgs(imports map[string]string, structs map[string]bool, fl *ast.FieldList) []actualArg {
+	if fl == nil {
 		return nil
 	}
+	var args []actualArg
+	for _, f := range fl.List {
+		arg := typeToFunctionArg(imports, f.Type)
+		a := actualArg{
+			Text: types.ExprString(f.Type),
+			Matches: func(want detect.FunctionArg, exact bool) bool {
+				var b binding
+				return b.bindArg(arg, want, structs)
+			},
+		}
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			args = append(args, a)
+		}
+	}
+	return args
+}
 
-	return fmt.Errorf("unable to find function %q in %q with matching signature", fn, pkg)
+func fieldArgs(imports map[string]string, fl *ast.FieldList) []detect.FunctionArg {
+	if fl == nil {
+		return nil
+	}
+	var args []detect.FunctionArg
+	for _, f := range fl.List {
+		arg := typeToFunctionArg(imports, f.Type)
+		// A field such as "a, b string" declares multiple arguments.
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			args = append(args, arg)
+		}
+	}
+	return args
 }
 
-// readModuleName is a terrible hack for yanking the module from go.mod file.
-// Should be replaced with something that actually understands go...
-func readModuleName(dctx packit.DetectContext) (string, error) {
-	modFile, err := os.Open(filepath.Join(dctx.WorkingDir, "go.mod"))
-	if err != nil {
-		return "", err
+func typeToFunctionArg(imports map[string]string, e ast.Expr) detect.FunctionArg {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		arg := typeToFunctionArg(imports, e.X)
+		arg.Pointer = true
+		return arg
+	case *ast.SelectorExpr:
+		if im, ok := e.X.(*ast.Ident); ok {
+			return detect.FunctionArg{ImportPath: imports[im.Name], Name: e.Sel.Name}
+		}
+	case *ast.Ident:
+		return detect.FunctionArg{Name: e.Name}
 	}
-	defer modFile.Close()
+	return detect.FunctionArg{}
+}
 
-	scanner := bufio.NewScanner(modFile)
-	for scanner.Scan() {
-		pieces := strings.Split(scanner.Text(), " ")
-		if len(pieces) >= 2 && pieces[0] == "module" {
-			return pieces[1], nil
+func (b *binding) bindArgs(got, want []detect.FunctionArg, structs map[string]bool) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !b.bindArg(got[i], want[i], structs) {
+			return false
 		}
 	}
-	return "", nil
+	return true
 }
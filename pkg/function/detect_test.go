@@ -1,21 +1,42 @@
 package function
 
 import (
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/paketo-buildpacks/packit"
 )
 
+// cnbPath is the directory of the buildpack, which holds the supported
+// signatures.
+const cnbPath = "../../buildpacks"
+
 func TestDetect(t *testing.T) {
 	const goodWD = "../../" // where our go.mod file lives
 
 	tests := []struct {
 		name  string
 		wd    string
+		root  string
 		pkg   string
 		fn    string
 		proto string
+		mode  string
+		flags string
 		match bool
+		want  string
+		ctor  string
+		data  string
+		res   string
+		path  string
+		types string
+		err   string
+		env   Detector
+		// wantPr is the protocol that detection selects, when it is
+		// not proto.
+		wantPr string
 	}{{
 		name:  "default function",
 		wd:    goodWD,
@@ -23,6 +44,14 @@ func TestDetect(t *testing.T) {
 		fn:    "Receiver",
 		proto: "http",
 		match: true,
+		want:  "Receiver",
+	}, {
+		name:  "default function (unset)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/default",
+		proto: "http",
+		match: true,
+		want:  "Receiver",
 	}, {
 		name:  "non-default function (no override)",
 		wd:    goodWD,
@@ -37,6 +66,36 @@ func TestDetect(t *testing.T) {
 		fn:    "MyCustomReceiver",
 		proto: "http",
 		match: true,
+		want:  "MyCustomReceiver",
+	}, {
+		name:  "non-default function (unset)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/nondefault",
+		proto: "http",
+		match: true,
+		want:  "MyCustomReceiver",
+	}, {
+		name:  "multiple functions (unset)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/multiple",
+		proto: "http",
+		match: false,
+		err:   "[[build.env]]\nname = \"CE_GO_FUNCTION\"",
+	}, {
+		name:  "multiple functions (override)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/multiple",
+		fn:    "OnOrderCreated",
+		proto: "http",
+		match: true,
+		want:  "OnOrderCreated",
+	}, {
+		name:  "unexported function (override)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/multiple",
+		fn:    "helper",
+		proto: "http",
+		match: false,
 	}, {
 		name:  "bad signature function",
 		wd:    goodWD,
@@ -58,6 +117,151 @@ func TestDetect(t *testing.T) {
 		fn:    "Receiver",
 		proto: "http",
 		match: false,
+	}, {
+		name:  "workspace module",
+		wd:    "./testdata/modules/workspace",
+		root:  "./app",
+		pkg:   "../fn",
+		proto: "http",
+		match: true,
+		want:  "Receiver",
+	}, {
+		name:  "build constraints (unset)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/constraints",
+		proto: "http",
+		match: true,
+		want:  "Handle",
+	}, {
+		name:  "build constraints (test file)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/constraints",
+		fn:    "Receiver",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "build constraints (other platform)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/constraints",
+		fn:    "Windows",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "build constraints (custom tag)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/constraints",
+		fn:    "Custom",
+		proto: "http",
+		flags: "-ldflags=-s -tags=custom",
+		match: true,
+		want:  "Custom",
+	}, {
+		name:  "method receiver (unset)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/method",
+		proto: "http",
+		match: true,
+		want:  "Handler.Receive",
+		ctor:  "NewHandler",
+	}, {
+		name:  "method receiver (override)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/method",
+		fn:    "Handler.Receive",
+		proto: "http",
+		match: true,
+		want:  "Handler.Receive",
+		ctor:  "NewHandler",
+	}, {
+		name:  "method receiver (no constructor)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/method",
+		fn:    "Orphan.Receive",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "method receiver (value constructor)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/method",
+		fn:    "Value.Receive",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "typed payload and result",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/payload",
+		fn:    "Handle",
+		proto: "http",
+		match: true,
+		want:  "Handle",
+		data:  "Order",
+		res:   "Confirmation",
+	}, {
+		name:  "typed payload",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/payload",
+		fn:    "Sink",
+		proto: "http",
+		match: true,
+		want:  "Sink",
+		data:  "Order",
+	}, {
+		name:  "typed payload (pointer)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/payload",
+		fn:    "Pointer",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "typed payload (not a struct)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/payload",
+		fn:    "NotStruct",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "directive",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/directive",
+		proto: "http",
+		match: true,
+		want:  "Handle",
+		path:  "/orders",
+		types: "com.example.order.*,com.example.refund",
+	}, {
+		name:  "directive (overridden)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/directive",
+		proto: "http",
+		env: Detector{
+			Path:  "/override",
+			Types: "com.example.other",
+		},
+		match: true,
+		want:  "Handle",
+		path:  "/override",
+		types: "com.example.other",
+	}, {
+		name:   "directive (tagged file)",
+		wd:     goodWD,
+		pkg:    "./pkg/function/testdata/taggeddirective",
+		match:  true,
+		want:   "Receive",
+		types:  "com.example.order",
+		wantPr: "kafka",
+	}, {
+		name:  "directive (unknown setting)",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/baddirective",
+		proto: "http",
+		match: false,
+	}, {
+		name:  "unsupported detection mode",
+		wd:    goodWD,
+		pkg:   "./pkg/function/testdata/default",
+		proto: "http",
+		mode:  "matt",
+		match: false,
 	}, {
 		name:  "unsupported protocol",
 		wd:    goodWD,
@@ -69,19 +273,194 @@ func TestDetect(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("BP_GO_BUILD_FLAGS", test.flags)
+			defer os.Unsetenv("BP_GO_BUILD_FLAGS")
+
 			d := Detector{
-				Package:  test.pkg,
-				Function: test.fn,
-				Protocol: test.proto,
+				ModuleRoot: test.root,
+				Package:    test.pkg,
+				Function:   test.fn,
+				Protocol:   test.proto,
+				Mode:       test.mode,
+				Path:       test.env.Path,
+				Types:      test.env.Types,
 			}
 			p, err := d.Detect(packit.DetectContext{
 				WorkingDir: test.wd,
+				CNBPath:    cnbPath,
 			})
 			if err != nil && test.match {
 				t.Fatal("Unexpected error:", err)
 			} else if err == nil && !test.match {
 				t.Fatal("Unexpected match:", p)
 			}
+			if err != nil {
+				if !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error = %v, wanted it to contain %q", err, test.err)
+				}
+				return
+			}
+
+			md := p.Plan.Requires[0].Metadata.(map[string]interface{})
+			if got := md["function"]; got != test.want {
+				t.Errorf("function = %v, wanted %q", got, test.want)
+			}
+			if got, _ := md["constructor"].(string); got != test.ctor {
+				t.Errorf("constructor = %q, wanted %q", got, test.ctor)
+			}
+			if got, _ := md["payload"].(string); got != test.data {
+				t.Errorf("payload = %q, wanted %q", got, test.data)
+			}
+			if got, _ := md["result"].(string); got != test.res {
+				t.Errorf("result = %q, wanted %q", got, test.res)
+			}
+			if got, _ := md["path"].(string); got != test.path {
+				t.Errorf("path = %q, wanted %q", got, test.path)
+			}
+			if got, _ := md["types"].(string); got != test.types {
+				t.Errorf("types = %q, wanted %q", got, test.types)
+			}
+			wantPr := test.wantPr
+			if wantPr == "" {
+				wantPr = test.proto
+			}
+			if got := md["protocol"]; got != wantPr {
+				t.Errorf("protocol = %v, wanted %q", got, wantPr)
+			}
+		})
+	}
+}
+
+func TestDetectRoutes(t *testing.T) {
+	const goodWD = "../../" // where our go.mod file lives
+
+	tests := []struct {
+		name   string
+		pkg    string
+		env    Detector
+		match  bool
+		path   string
+		routes []map[string]interface{}
+	}{{
+		name:  "routed by directives",
+		pkg:   "./pkg/function/testdata/routes",
+		match: true,
+		path:  "/events",
+		routes: []map[string]interface{}{{
+			"function":  "OnOrder",
+			"signature": "func(context.Context, cloudevents.Event) error",
+			"in":        "context.Context,cloudevents.Event",
+			"out":       "error",
+			"adapter":   "return nil, fn(ctx, event)",
+			"native":    true,
+			"types":     "com.example.order.*",
+		}, {
+			"function":  "OnRefund",
+			"signature": "func(cloudevents.Event)",
+			"in":        "cloudevents.Event",
+			"adapter":   "fn(event)\nreturn nil, nil",
+			"native":    true,
+			"types":     "com.example.refund",
+			"source":    "/billing",
+		}},
+	}, {
+		name: "routed by environment",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOther=com.example.other,com.example.misc@/misc OnRefund",
+		},
+		match: true,
+		routes: []map[string]interface{}{{
+			"function":  "OnOther",
+			"signature": "func(cloudevents.Event)",
+			"in":        "cloudevents.Event",
+			"adapter":   "fn(event)\nreturn nil, nil",
+			"native":    true,
+			"types":     "com.example.other,com.example.misc",
+			"source":    "/misc",
+		}, {
+			"function":  "OnRefund",
+			"signature": "func(cloudevents.Event)",
+			"in":        "cloudevents.Event",
+			"adapter":   "fn(event)\nreturn nil, nil",
+			"native":    true,
+			"types":     "com.example.refund",
+			"source":    "/billing",
+		}},
+	}, {
+		name: "missing types",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOrder OnOther",
+		},
+		match: false,
+	}, {
+		name: "missing function",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOrder OnMissing=com.example.missing",
+		},
+		match: false,
+	}, {
+		name: "malformed entry",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOrder OnOther=",
+		},
+		match: false,
+	}, {
+		name: "repeated function",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOrder OnOrder=com.example.other",
+		},
+		match: false,
+	}, {
+		name: "function and functions",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Function:  "OnOrder",
+			Functions: "OnOrder OnRefund",
+		},
+		match: false,
+	}, {
+		name: "types and functions",
+		pkg:  "./pkg/function/testdata/routes",
+		env: Detector{
+			Functions: "OnOrder OnRefund",
+			Types:     "com.example.other",
+		},
+		match: false,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := test.env
+			d.ModuleRoot = "."
+			d.Package = test.pkg
+			p, err := d.Detect(packit.DetectContext{
+				WorkingDir: goodWD,
+				CNBPath:    cnbPath,
+			})
+			if err != nil && test.match {
+				t.Fatal("Unexpected error:", err)
+			} else if err == nil && !test.match {
+				t.Fatal("Unexpected match:", p)
+			}
+			if err != nil {
+				return
+			}
+
+			md := p.Plan.Requires[0].Metadata.(map[string]interface{})
+			if got, ok := md["function"]; ok {
+				t.Errorf("function = %v, wanted none", got)
+			}
+			if got, _ := md["path"].(string); got != test.path {
+				t.Errorf("path = %q, wanted %q", got, test.path)
+			}
+			if got := md["routes"]; !reflect.DeepEqual(got, test.routes) {
+				t.Errorf("routes = %v, wanted %v", got, test.routes)
+			}
 		})
 	}
 }
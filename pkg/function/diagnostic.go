@@ -0,0 +1,335 @@
+package function
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+// Report explains why detection found no function with a supported
+// signature.  It is returned as the error from Detect, and is encoded as
+// JSON for other tooling to consume.
+type Report struct {
+	// Package is the import path of the package that was searched.
+	Package string `json:"package"`
+
+	// Protocol is the protocol whose signatures were matched.
+	Protocol string `json:"protocol"`
+
+	// Function is the name of the configured function, if any.
+	Function string `json:"function,omitempty"`
+
+	// Diagnostics explain the mismatch of the configured function, or of
+	// each exported function when none was configured.
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
+
+// Error implements error.
+func (r *Report) Error() string {
+	if r.Function != "" && len(r.Diagnostics) == 1 {
+		return r.Diagnostics[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "unable to find a function in %q with matching signature", r.Package)
+	for _, d := range r.Diagnostics {
+		b.WriteString("\n")
+		b.WriteString(d.Error())
+	}
+	return b.String()
+}
+
+// Diagnostic explains why a function doesn't match any of the supported
+// signatures, by comparing it to the closest ones.
+type Diagnostic struct {
+	// Function is the name of the function, or Type.Method for methods.
+	Function string `json:"function"`
+
+	// Position is the location of the function's declaration.
+	Position string `json:"position,omitempty"`
+
+	// Signature is the function's actual signature.
+	Signature string `json:"signature"`
+
+	// Mismatches explains how the function's signature differs from the
+	// closest supported signatures.
+	Mismatches []string `json:"mismatches"`
+
+	// Closest holds the supported signatures that are the fewest changes
+	// away from the function's signature.
+	Closest []NearMiss `json:"closest"`
+
+	// distance is the number of changes to the closest signatures.
+	distance int
+}
+
+// nearMiss returns whether the function is only a couple of changes away
+// from a supported signature, so that it was likely meant to match one.
+func (d *Diagnostic) nearMiss() bool {
+	return d.distance <= 2
+}
+
+// NearMiss describes a supported signature that is close to a function's
+// signature.
+type NearMiss struct {
+	// Signature is the supported signature, in which T stands for an
+	// exported struct type declared in the function's package.
+	Signature string `json:"signature"`
+
+	// Mismatches explains how the function's signature differs from it.
+	Mismatches []string `json:"mismatches"`
+}
+
+// Error implements error.
+func (d *Diagnostic) Error() string {
+	var b strings.Builder
+	if d.Position != "" {
+		fmt.Fprintf(&b, "%s: ", d.Position)
+	}
+	fmt.Fprintf(&b, "%s has signature %s, which does not match a supported signature", d.Function, d.Signature)
+	for _, m := range d.Mismatches {
+		fmt.Fprintf(&b, "\n  %s", m)
+	}
+	if len(d.Closest) > 0 {
+		b.WriteString("\n  closest supported signatures:")
+		for _, nm := range d.Closest {
+			fmt.Fprintf(&b, "\n    %s", nm.Signature)
+		}
+	}
+	return b.String()
+}
+
+// actualArg describes a parameter or result of a function, as it is shown
+// in diagnostics, along with how it is matched against signatures.
+type actualArg struct {
+	Text string
+
+	// Matches returns whether the argument matches want, where exact is
+	// set when the signature must match exactly (see matchTypedSignature).
+	Matches func(want detect.FunctionArg, exact bool) bool
+}
+
+// mismatch describes how an argument of a function differs from a
+// supported signature.  An Index of -1 describes the number of arguments.
+type mismatch struct {
+	Result bool
+	Index  int
+	Got    string
+	Want   string
+}
+
+// String explains the mismatch.
+func (m mismatch) String() string {
+	return m.explain(quoted(m.Want))
+}
+
+// explain explains the mismatch, with the given expectation.
+func (m mismatch) explain(want string) string {
+	switch {
+	case m.Index >= 0 && m.Result:
+		return fmt.Sprintf("%s return value is `%s`, expected %s", ordinal(m.Index), m.Got, want)
+	case m.Index >= 0:
+		return fmt.Sprintf("%s parameter is `%s`, expected %s", ordinal(m.Index), m.Got, want)
+	case m.Result:
+		return fmt.Sprintf("returns %s, expected %s", m.Got, want)
+	default:
+		return fmt.Sprintf("takes %s, expected %s", m.Got, want)
+	}
+}
+
+// diagnose compares the function name, whose signature is described by text,
+// in and out, against sigs.
+func diagnose(name, pos, text string, in, out []actualArg, sigs []signature) *Diagnostic {
+	d := &Diagnostic{
+		Function:  name,
+		Position:  pos,
+		Signature: text,
+	}
+
+	var closest [][]mismatch
+	best := -1
+	for _, sig := range sigs {
+		exact := hasPlaceholders(sig.FunctionSignature)
+		ms := append(compareArgs(in, sig.In, false, exact), compareArgs(out, sig.Out, true, exact)...)
+		// Adding or removing arguments is a bigger change than changing
+		// their types.
+		score := len(ms)
+		if d := len(in) - len(sig.In); d != 0 {
+			score += 2*abs(d) - 1
+		}
+		if d := len(out) - len(sig.Out); d != 0 {
+			score += 2*abs(d) - 1
+		}
+		switch {
+		case best < 0 || score < best:
+			best = score
+			closest = [][]mismatch{ms}
+			d.Closest = nil
+		case score > best:
+			continue
+		default:
+			closest = append(closest, ms)
+		}
+		nm := NearMiss{Signature: formatSignature(sig.FunctionSignature)}
+		for _, m := range ms {
+			nm.Mismatches = append(nm.Mismatches, m.String())
+		}
+		d.Closest = append(d.Closest, nm)
+	}
+
+	// Combine the expectations of the closest signatures for each argument.
+	type key struct {
+		Result bool
+		Index  int
+	}
+	var keys []key
+	byKey := make(map[key][]mismatch)
+	for _, ms := range closest {
+		for _, m := range ms {
+			k := key{Result: m.Result, Index: m.Index}
+			if _, ok := byKey[k]; !ok {
+				keys = append(keys, k)
+			}
+			byKey[k] = append(byKey[k], m)
+		}
+	}
+	for _, k := range keys {
+		var wants []string
+		seen := make(map[string]bool)
+		for _, m := range byKey[k] {
+			if !seen[m.Want] {
+				seen[m.Want] = true
+				wants = append(wants, quoted(m.Want))
+			}
+		}
+		d.Mismatches = append(d.Mismatches, byKey[k][0].explain(joinOr(wants)))
+	}
+	d.distance = best
+	return d
+}
+
+// compareArgs compares the arguments got against want, which are the
+// results of a function when result is set, or its parameters otherwise.
+func compareArgs(got []actualArg, want []detect.FunctionArg, result, exact bool) []mismatch {
+	if len(got) != len(want) {
+		noun := "parameter"
+		if result {
+			noun = "value"
+		}
+		return []mismatch{{
+			Result: result,
+			Index:  -1,
+			Got:    count(len(got), noun),
+			Want:   count(len(want), noun),
+		}}
+	}
+	var ms []mismatch
+	for i, arg := range want {
+		if !got[i].Matches(arg, exact) {
+			ms = append(ms, mismatch{
+				Result: result,
+				Index:  i,
+				Got:    got[i].Text,
+				Want:   formatArg(arg),
+			})
+		}
+	}
+	return ms
+}
+
+// formatSignature formats sig as it would be written in source.
+func formatSignature(sig detect.FunctionSignature) string {
+	in, out := formatArgs(sig.In), formatArgs(sig.Out)
+	s := "func(" + strings.Join(in, ", ") + ")"
+	switch len(out) {
+	case 0:
+		return s
+	case 1:
+		return s + " " + out[0]
+	default:
+		return s + " (" + strings.Join(out, ", ") + ")"
+	}
+}
+
+// formatArgs formats args as they would be written in source.
+func formatArgs(args []detect.FunctionArg) []string {
+	s := make([]string, 0, len(args))
+	for _, arg := range args {
+		s = append(s, formatArg(arg))
+	}
+	return s
+}
+
+// packageNames holds the names of packages whose names differ from the last
+// element of their import paths.
+var packageNames = map[string]string{
+	"github.com/cloudevents/sdk-go/v2": "cloudevents",
+}
+
+// formatArg formats arg as it would be written in source, with T standing
+// for the user's types.
+func formatArg(arg detect.FunctionArg) string {
+	s := arg.Name
+	if isPlaceholder(arg) {
+		s = "T"
+	} else if arg.ImportPath != "" {
+		name, ok := packageNames[arg.ImportPath]
+		if !ok {
+			name = path.Base(arg.ImportPath)
+		}
+		s = name + "." + s
+	}
+	if arg.Pointer {
+		s = "*" + s
+	}
+	return s
+}
+
+// quoted quotes a formatted argument, or explains a placeholder for the
+// user's types.
+func quoted(arg string) string {
+	switch arg {
+	case "T":
+		return "an exported struct type declared in the function's package"
+	case "*T":
+		return "a pointer to an exported struct type declared in the function's package"
+	}
+	if strings.Contains(arg, " ") {
+		return arg
+	}
+	return "`" + arg + "`"
+}
+
+// joinOr joins the alternatives, e.g. "a, b or c".
+func joinOr(alts []string) string {
+	if len(alts) < 2 {
+		return strings.Join(alts, "")
+	}
+	return strings.Join(alts[:len(alts)-1], ", ") + " or " + alts[len(alts)-1]
+}
+
+// count formats n of noun, e.g. "1 parameter" or "2 parameters".
+func count(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// abs returns the absolute value of i.
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// ordinal returns the ordinal of the zero-based index i.
+func ordinal(i int) string {
+	ordinals := []string{"first", "second", "third", "fourth", "fifth"}
+	if i < len(ordinals) {
+		return ordinals[i]
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
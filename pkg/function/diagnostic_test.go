@@ -0,0 +1,150 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name       string
+		wd         string
+		pkg        string
+		fn         string
+		mode       string
+		functions  []string
+		mismatches []string
+		closest    []string
+	}{{
+		name:      "second return value",
+		wd:        "../../",
+		pkg:       "./pkg/function/testdata/nearmiss",
+		fn:        "Receiver",
+		functions: []string{"Receiver"},
+		mismatches: []string{
+			"second return value is `bool`, expected `protocol.Result` or `error`",
+		},
+		closest: []string{
+			"func(context.Context, cloudevents.Event) (*cloudevents.Event, protocol.Result)",
+			"func(context.Context, cloudevents.Event) (*cloudevents.Event, error)",
+		},
+	}, {
+		name:      "pointer payload",
+		wd:        "../../",
+		pkg:       "./pkg/function/testdata/nearmiss",
+		fn:        "Orders",
+		functions: []string{"Orders"},
+		mismatches: []string{
+			"second parameter is `*Order`, expected `cloudevents.Event` or an exported struct type declared in the function's package",
+		},
+		closest: []string{
+			"func(context.Context, cloudevents.Event) error",
+			"func(context.Context, T) error",
+		},
+	}, {
+		name:      "near misses (unset)",
+		wd:        "../../",
+		pkg:       "./pkg/function/testdata/nearmiss",
+		functions: []string{"Orders", "Receiver"},
+	}, {
+		name:      "second return value (types)",
+		wd:        "./testdata/typed",
+		pkg:       "./nearmiss",
+		fn:        "Receiver",
+		mode:      "types",
+		functions: []string{"Receiver"},
+		mismatches: []string{
+			"second return value is `bool`, expected `protocol.Result` or `error`",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.mode == "types" {
+				if _, err := exec.LookPath("go"); err != nil {
+					t.Skip("go command not available")
+				}
+			}
+			report := filepath.Join(t.TempDir(), "report.json")
+			d := Detector{
+				ModuleRoot: ".",
+				Package:    test.pkg,
+				Function:   test.fn,
+				Protocol:   "http",
+				Mode:       test.mode,
+				ReportFile: report,
+			}
+			_, err := d.Detect(packit.DetectContext{
+				WorkingDir: test.wd,
+				CNBPath:    cnbPath,
+			})
+			var r *Report
+			if !errors.As(err, &r) {
+				t.Fatalf("Detect() = %v, wanted a report", err)
+			}
+			if test.fn != "" && !strings.Contains(err.Error(), test.mismatches[0]) {
+				t.Errorf("Detect() = %v, wanted it to contain %q", err, test.mismatches[0])
+			}
+
+			// The report file holds the same report.
+			data, err := ioutil.ReadFile(report)
+			if err != nil {
+				t.Fatal("ReadFile() =", err)
+			}
+			var got Report
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal("Unmarshal() =", err)
+			}
+			if got.Function != test.fn {
+				t.Errorf("function = %q, wanted %q", got.Function, test.fn)
+			}
+			var functions []string
+			for _, diag := range got.Diagnostics {
+				functions = append(functions, diag.Function)
+			}
+			if !reflect.DeepEqual(functions, test.functions) {
+				t.Errorf("functions = %v, wanted %v", functions, test.functions)
+			}
+			if test.mismatches == nil {
+				return
+			}
+			if got := got.Diagnostics[0].Mismatches; !reflect.DeepEqual(got, test.mismatches) {
+				t.Errorf("mismatches = %q, wanted %q", got, test.mismatches)
+			}
+			if test.closest == nil {
+				return
+			}
+			var closest []string
+			for _, nm := range got.Diagnostics[0].Closest {
+				closest = append(closest, nm.Signature)
+			}
+			if !reflect.DeepEqual(closest, test.closest) {
+				t.Errorf("closest = %q, wanted %q", closest, test.closest)
+			}
+		})
+	}
+
+	// No report is written when detection succeeds.
+	report := filepath.Join(t.TempDir(), "report.json")
+	d := Detector{
+		ModuleRoot: ".",
+		Package:    "./pkg/function/testdata/default",
+		Protocol:   "http",
+		ReportFile: report,
+	}
+	if _, err := d.Detect(packit.DetectContext{WorkingDir: "../../", CNBPath: cnbPath}); err != nil {
+		t.Fatal("Detect() =", err)
+	}
+	if _, err := os.Stat(report); !os.IsNotExist(err) {
+		t.Errorf("Stat() = %v, wanted not to exist", err)
+	}
+}
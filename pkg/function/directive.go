@@ -0,0 +1,120 @@
+package function
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// directivePrefix starts a comment on a function that configures how it is
+// wrapped, followed by key=value settings, for example:
+// "//cloudevents:function protocol=http path=/orders types=com.example.order.*"
+const directivePrefix = "//cloudevents:function"
+
+// directiveKeys holds the settings that a directive may contain.
+var directiveKeys = map[string]bool{
+	// protocol selects the protocol binding, like CE_PROTOCOL.
+	"protocol": true,
+	// path is the HTTP path on which events are received, like CE_PATH.
+	"path": true,
+	// types is a comma-separated list of the event types the function
+	// accepts, which may contain wildcards, like CE_TYPES.
+	"types": true,
+	// source is the source of the events the function accepts.
+	"source": true,
+}
+
+// directive holds the settings of a //cloudevents:function comment.
+type directive map[string]string
+
+// parseDirective parses the settings of the directive comment text.
+func parseDirective(text string) (directive, error) {
+	d := directive{}
+	for _, field := range strings.Fields(strings.TrimPrefix(text, directivePrefix)) {
+		i := strings.Index(field, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed setting %q, expected key=value", field)
+		}
+		key, value := field[:i], field[i+1:]
+		if !directiveKeys[key] {
+			return nil, fmt.Errorf("unknown setting %q", key)
+		} else if _, ok := d[key]; ok {
+			return nil, fmt.Errorf("repeated setting %q", key)
+		}
+		d[key] = value
+	}
+	return d, nil
+}
+
+// findDirectives parses the Go files in dir that go build would compile
+// with the given build tags, and returns the directives on its functions,
+// methods (as Type.Method) and variables, keyed by name.
+func findDirectives(dir string, tags []string) (map[string]directive, error) {
+	files, err := buildFiles(dir, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	directives := make(map[string]directive)
+	fset := token.NewFileSet()
+	for _, f := range files {
+		astFile, err := parser.ParseFile(fset, f, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		add := func(name string, doc *ast.CommentGroup) error {
+			if doc == nil {
+				return nil
+			}
+			for _, c := range doc.List {
+				if c.Text != directivePrefix && !strings.HasPrefix(c.Text, directivePrefix+" ") {
+					continue
+				}
+				if _, ok := directives[name]; ok {
+					return fmt.Errorf("%s: repeated %s directive", fset.Position(c.Pos()), directivePrefix)
+				}
+				d, err := parseDirective(c.Text)
+				if err != nil {
+					return fmt.Errorf("%s: %w", fset.Position(c.Pos()), err)
+				}
+				directives[name] = d
+			}
+			return nil
+		}
+
+		for _, decl := range astFile.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				name := decl.Name.Name
+				if decl.Recv != nil {
+					typeName, _ := receiverType(decl)
+					name = typeName + "." + name
+				}
+				if err := add(name, decl.Doc); err != nil {
+					return nil, err
+				}
+
+			case *ast.GenDecl:
+				if decl.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					vs := spec.(*ast.ValueSpec)
+					doc := vs.Doc
+					if doc == nil && len(decl.Specs) == 1 {
+						doc = decl.Doc
+					}
+					for _, n := range vs.Names {
+						if err := add(n.Name, doc); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		}
+	}
+	return directives, nil
+}
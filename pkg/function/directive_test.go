@@ -0,0 +1,64 @@
+package function
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    directive
+		success bool
+	}{{
+		name:    "empty",
+		text:    "//cloudevents:function",
+		want:    directive{},
+		success: true,
+	}, {
+		name: "all settings",
+		text: "//cloudevents:function protocol=http  path=/orders types=a.*,b",
+		want: directive{
+			"protocol": "http",
+			"path":     "/orders",
+			"types":    "a.*,b",
+		},
+		success: true,
+	}, {
+		name:    "empty value",
+		text:    "//cloudevents:function path=",
+		want:    directive{"path": ""},
+		success: true,
+	}, {
+		name: "malformed setting",
+		text: "//cloudevents:function http",
+	}, {
+		name: "missing key",
+		text: "//cloudevents:function =http",
+	}, {
+		name: "unknown setting",
+		text: "//cloudevents:function color=blue",
+	}, {
+		name: "repeated setting",
+		text: "//cloudevents:function path=/a path=/b",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDirective(test.text)
+			if !test.success {
+				if err == nil {
+					t.Errorf("parseDirective() = %v, wanted error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDirective() = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseDirective() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
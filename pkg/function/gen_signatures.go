@@ -0,0 +1,39 @@
+//go:build ignore
+// +build ignore
+
+// gen_signatures copies the signatures shipped in the buildpack into
+// signatures_generated.go, so that they are built into tools that run
+// without the buildpack, such as ce-fn.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+func main() {
+	data, err := ioutil.ReadFile("../../buildpacks/signatures.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if strings.Contains(string(data), "`") {
+		log.Fatal("signatures.json must not contain backquotes")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gen_signatures.go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package function\n\n")
+	fmt.Fprintf(&buf, "// builtinSignatures holds the contents of the buildpack's signatures.json.\n")
+	fmt.Fprintf(&buf, "const builtinSignatures = `%s`\n", data)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("signatures_generated.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package function
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+// constructorName returns the name of the function that constructs the
+// receivers of methods on the type typeName, e.g. NewHandler for Handler.
+func constructorName(typeName string) string {
+	return "New" + typeName
+}
+
+// splitMethod splits a function name of the form Type.Method into its parts.
+// For plain functions, the type is empty.
+func splitMethod(name string) (typeName, method string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// constructorError describes the constructor that the method fn on the type
+// typeName is missing.
+func constructorError(fn, typeName string) error {
+	return fmt.Errorf("method %s requires a constructor: func %s(context.Context) (*%s, error)",
+		fn, constructorName(typeName), typeName)
+}
+
+// receiverType returns the name of the type that the method fd is declared
+// on, and whether the method has a pointer receiver.
+func receiverType(fd *ast.FuncDecl) (string, bool) {
+	if fd.Recv == nil || len(fd.Recv.List) != 1 {
+		return "", false
+	}
+	switch t := fd.Recv.List[0].Type.(type) {
+	case *ast.Ident:
+		return t.Name, false
+	case *ast.StarExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name, true
+		}
+	}
+	return "", false
+}
+
+// isConstructor checks whether ft is the signature of a constructor for the
+// type typeName, i.e. func(context.Context) (*T, error), as written in source.
+// The constructor may also return T when the method has a value receiver.
+func isConstructor(imports map[string]string, ft *ast.FuncType, typeName string, pointer bool) bool {
+	in := fieldArgs(imports, ft.Params)
+	out := fieldArgs(imports, ft.Results)
+	if len(in) != 1 || in[0] != (detect.FunctionArg{ImportPath: "context", Name: "Context"}) || len(out) != 2 {
+		return false
+	}
+	return out[0].ImportPath == "" && out[0].Name == typeName && (out[0].Pointer || !pointer) &&
+		out[1] == detect.FunctionArg{Name: "error"}
+}
+
+// isTypedConstructor checks whether ctor has a signature like
+// func(context.Context) (*T, error), and constructs values on which method
+// can be called.
+func isTypedConstructor(imp types.Importer, ctor *types.Func, named *types.Named, method *types.Func) bool {
+	sig := ctor.Type().(*types.Signature)
+	if sig.Variadic() || sig.Params().Len() != 1 || sig.Results().Len() != 2 {
+		return false
+	}
+	ctx, err := resolveArg(imp, detect.FunctionArg{ImportPath: "context", Name: "Context"})
+	if err != nil || !types.AssignableTo(ctx, sig.Params().At(0).Type()) {
+		return false
+	}
+	if !types.Identical(sig.Results().At(1).Type(), types.Universe.Lookup("error").Type()) {
+		return false
+	}
+	rt := sig.Results().At(0).Type()
+	if !types.Identical(rt, named) && !types.Identical(rt, types.NewPointer(named)) {
+		return false
+	}
+	obj, _, _ := types.LookupFieldOrMethod(rt, false, method.Pkg(), method.Name())
+	return obj == method
+}
@@ -0,0 +1,343 @@
+package function
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// goModule describes a go.mod file and the directory containing it.
+type goModule struct {
+	Dir  string
+	File *modfile.File
+}
+
+// Path returns the module path declared by the go.mod file.
+func (m *goModule) Path() string {
+	return m.File.Module.Mod.Path
+}
+
+// resolvePackage returns the import path of the package in the directory pkg
+// (relative to root).  root is the directory containing the main module,
+// which holds the generated scaffolding.  The package may live in the main
+// module, or in another module within workingDir that the main module can
+// reach through a replace directive or a go.work workspace.
+func resolvePackage(workingDir, root, pkg string) (string, error) {
+	mainDir := filepath.Join(workingDir, root)
+	main, err := readModule(mainDir)
+	if err != nil {
+		return "", err
+	}
+
+	pkgDir := filepath.Join(mainDir, pkg)
+	if !within(workingDir, pkgDir) {
+		return "", fmt.Errorf("package %q is outside of the application directory", pkg)
+	}
+	if fi, err := os.Stat(pkgDir); err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		return "", fmt.Errorf("package %q is not a directory", pkg)
+	}
+
+	owner, err := enclosingModule(workingDir, pkgDir)
+	if err != nil {
+		return "", err
+	}
+	if owner.Dir != main.Dir {
+		if err := checkReachable(workingDir, main, owner); err != nil {
+			return "", err
+		}
+	}
+
+	rel, err := filepath.Rel(owner.Dir, pkgDir)
+	if err != nil {
+		return "", err
+	}
+	importPath := path.Join(owner.Path(), filepath.ToSlash(rel))
+	if err := module.CheckImportPath(importPath); err != nil {
+		return "", err
+	}
+	return importPath, nil
+}
+
+// readModule parses the go.mod file in dir.
+func readModule(dir string) (*goModule, error) {
+	p := filepath.Join(dir, "go.mod")
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	// We parse leniently, so that directives introduced by newer versions of
+	// Go don't break detection.  The directives we care about (module and
+	// replace) are still validated.
+	f, err := modfile.ParseLax(p, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Module == nil || f.Module.Mod.Path == "" {
+		return nil, fmt.Errorf("%s: missing module directive", p)
+	}
+	// ParseLax ignores replace directives, which only apply to the main module,
+	// so collect them from the syntax tree.
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if len(x.Token) > 0 && x.Token[0] == "replace" {
+				if err := addReplace(f, x.Token[1:]); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", p, x.Start.Line, err)
+				}
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) == 1 && x.Token[0] == "replace" {
+				for _, l := range x.Line {
+					if err := addReplace(f, l.Token); err != nil {
+						return nil, fmt.Errorf("%s:%d: %w", p, l.Start.Line, err)
+					}
+				}
+			}
+		}
+	}
+	return &goModule{Dir: dir, File: f}, nil
+}
+
+// addReplace records the replace directive with the given arguments, which
+// take the form: old [version] => new [version].
+func addReplace(f *modfile.File, args []string) error {
+	arrow := -1
+	for i, a := range args {
+		if a == "=>" {
+			arrow = i
+		}
+	}
+	if arrow < 1 || arrow > 2 || len(args)-arrow < 2 || len(args)-arrow > 3 {
+		return fmt.Errorf("usage: replace module/path [v1.2.3] => other/module v1.4 | ./local/dir")
+	}
+	var err error
+	unquote := func(s string) string {
+		if err != nil || !strings.HasPrefix(s, `"`) {
+			return s
+		}
+		var u string
+		if u, err = strconv.Unquote(s); err != nil {
+			return s
+		}
+		return u
+	}
+	r := &modfile.Replace{
+		Old: module.Version{Path: unquote(args[0])},
+		New: module.Version{Path: unquote(args[arrow+1])},
+	}
+	if arrow == 2 {
+		r.Old.Version = unquote(args[1])
+	}
+	if len(args)-arrow == 3 {
+		r.New.Version = unquote(args[arrow+2])
+	}
+	if err != nil {
+		return err
+	}
+	f.Replace = append(f.Replace, r)
+	return nil
+}
+
+// requiredVersion returns the version of the module path that the main
+// module m requires, followed by its replacement if any, as go list -m would
+// show it, or "" when m doesn't require the module.
+func (m *goModule) requiredVersion(path string) string {
+	var version string
+	for _, r := range m.File.Require {
+		if r.Mod.Path == path {
+			version = r.Mod.Version
+		}
+	}
+	if version == "" {
+		return ""
+	}
+	switch r := m.replacement(path, version); {
+	case r.Path == path && r.Version == version:
+		return version
+	case r.Version == "":
+		return version + " => " + r.Path
+	default:
+		return version + " => " + r.Path + " " + r.Version
+	}
+}
+
+// inModule returns whether the package imp belongs to the module path, or
+// to one of the modules nested in it.
+func inModule(imp, path string) bool {
+	return imp == path || strings.HasPrefix(imp, path+"/")
+}
+
+// provider returns the requirement of the main module m that provides the
+// package imp, which is the one with the longest matching module path, or
+// nil if there is none.
+func (m *goModule) provider(imp string) *modfile.Require {
+	var best *modfile.Require
+	for _, r := range m.File.Require {
+		if inModule(imp, r.Mod.Path) && (best == nil || len(r.Mod.Path) > len(best.Mod.Path)) {
+			best = r
+		}
+	}
+	return best
+}
+
+// replacement returns the module that replaces version of the module path in
+// the main module m, which has no version when it is replaced by a directory,
+// or the module itself when it isn't replaced.
+func (m *goModule) replacement(path, version string) module.Version {
+	for _, r := range m.File.Replace {
+		if r.Old.Path == path && (r.Old.Version == "" || r.Old.Version == version) {
+			return r.New
+		}
+	}
+	return module.Version{Path: path, Version: version}
+}
+
+// packageDir returns the directory of the package pkg, which belongs to the
+// main module in moduleDir, to a module of its go.work workspace, or to a
+// module that it replaces with a local directory, as resolvePackage requires.
+func packageDir(workingDir, moduleDir, pkg string) (string, error) {
+	main, err := readModule(moduleDir)
+	if err != nil {
+		return "", err
+	}
+	dirs := map[string]string{main.Path(): main.Dir}
+	uses, err := workspaceUses(workingDir, moduleDir)
+	if err != nil {
+		return "", err
+	}
+	for dir := range uses {
+		m, err := readModule(dir)
+		if err != nil {
+			return "", err
+		}
+		dirs[m.Path()] = m.Dir
+	}
+	for _, r := range main.File.Replace {
+		if !modfile.IsDirectoryPath(r.New.Path) {
+			continue
+		}
+		dir := r.New.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(main.Dir, dir)
+		}
+		dirs[r.Old.Path] = filepath.Clean(dir)
+	}
+
+	// The module with the longest matching path contains the package.
+	var best string
+	for modPath := range dirs {
+		if inModule(pkg, modPath) && len(modPath) > len(best) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("package %q is not in the main module %q or a local module that it uses", pkg, main.Path())
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(pkg, best), "/")
+	return filepath.Join(dirs[best], filepath.FromSlash(rel)), nil
+}
+
+// enclosingModule finds the module containing dir by walking up towards
+// workingDir.
+func enclosingModule(workingDir, dir string) (*goModule, error) {
+	for d := dir; within(workingDir, d); d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return readModule(d)
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("unable to find go.mod for %q", dir)
+}
+
+// checkReachable checks that the main module is able to import packages from
+// the module owner, which lives in a different directory.
+func checkReachable(workingDir string, main, owner *goModule) error {
+	// A go.work workspace that uses both modules makes them visible to
+	// each other.
+	if uses, err := workspaceUses(workingDir, main.Dir); err != nil {
+		return err
+	} else if uses[main.Dir] && uses[owner.Dir] {
+		return nil
+	}
+
+	// Otherwise the main module needs to replace the module with its local
+	// directory.
+	for _, r := range main.File.Replace {
+		if r.Old.Path != owner.Path() || !modfile.IsDirectoryPath(r.New.Path) {
+			continue
+		}
+		dir := r.New.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(main.Dir, dir)
+		}
+		if filepath.Clean(dir) == owner.Dir {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("module %q in %q is not reachable from module %q, add the following to %s:\n\nreplace %s => %s",
+		owner.Path(), owner.Dir, main.Path(), filepath.Join(main.Dir, "go.mod"),
+		owner.Path(), localPath(main.Dir, owner.Dir))
+}
+
+// workspaceUses returns the set of module directories used by the go.work
+// file governing dir, if any.
+func workspaceUses(workingDir, dir string) (map[string]bool, error) {
+	for d := dir; within(workingDir, d); d = filepath.Dir(d) {
+		p := filepath.Join(d, "go.work")
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			if d == filepath.Dir(d) {
+				break
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		wf, err := modfile.ParseWork(p, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		uses := make(map[string]bool, len(wf.Use))
+		for _, u := range wf.Use {
+			ud := u.Path
+			if !filepath.IsAbs(ud) {
+				ud = filepath.Join(d, ud)
+			}
+			uses[filepath.Clean(ud)] = true
+		}
+		return uses, nil
+	}
+	return nil, nil
+}
+
+// within returns whether dir is base or one of its subdirectories.
+func within(base, dir string) bool {
+	rel, err := filepath.Rel(base, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// localPath returns the path of dir relative to base in the form expected
+// by a replace directive.
+func localPath(base, dir string) string {
+	rel, err := filepath.Rel(base, dir)
+	if err != nil {
+		return dir
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
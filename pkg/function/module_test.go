@@ -0,0 +1,211 @@
+package function
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePackage(t *testing.T) {
+	const modules = "./testdata/modules"
+
+	tests := []struct {
+		name    string
+		wd      string
+		root    string
+		pkg     string
+		want    string
+		success bool
+	}{{
+		name:    "this module",
+		wd:      "../../",
+		root:    ".",
+		pkg:     "./pkg/function/testdata/default",
+		want:    "github.com/mattmoor/cloudevents-go-fn/pkg/function/testdata/default",
+		success: true,
+	}, {
+		name:    "quoted module path",
+		wd:      modules + "/quoted",
+		root:    ".",
+		pkg:     ".",
+		want:    "example.com/quoted",
+		success: true,
+	}, {
+		name:    "module block",
+		wd:      modules + "/block",
+		root:    ".",
+		pkg:     ".",
+		want:    "example.com/block",
+		success: true,
+	}, {
+		name: "missing module directive",
+		wd:   modules + "/nomodule",
+		root: ".",
+		pkg:  ".",
+	}, {
+		name: "missing go.mod",
+		wd:   ".",
+		root: ".",
+		pkg:  "./testdata/default",
+	}, {
+		name: "missing package",
+		wd:   modules + "/quoted",
+		root: ".",
+		pkg:  "./missing",
+	}, {
+		name: "package outside of the application",
+		wd:   modules + "/replace",
+		root: ".",
+		pkg:  "../quoted",
+	}, {
+		name:    "replaced module",
+		wd:      modules + "/replace",
+		root:    ".",
+		pkg:     "./fn",
+		want:    "example.com/fn",
+		success: true,
+	}, {
+		name: "unreachable module",
+		wd:   modules + "/replace",
+		root: ".",
+		pkg:  "./other",
+	}, {
+		name:    "module root",
+		wd:      modules + "/replace",
+		root:    "./fn",
+		pkg:     ".",
+		want:    "example.com/fn",
+		success: true,
+	}, {
+		name:    "workspace module",
+		wd:      modules + "/workspace",
+		root:    "./app",
+		pkg:     "../fn",
+		want:    "example.com/fn",
+		success: true,
+	}, {
+		name:    "workspace package",
+		wd:      modules + "/workspace",
+		root:    "./app",
+		pkg:     "../fn/sub",
+		want:    "example.com/fn/sub",
+		success: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolvePackage(test.wd, test.root, test.pkg)
+			if err != nil && test.success {
+				t.Fatal("Unexpected error:", err)
+			} else if err == nil && !test.success {
+				t.Fatal("Unexpected success:", got)
+			}
+			if got != test.want {
+				t.Errorf("resolvePackage() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPackageDir(t *testing.T) {
+	const modules = "./testdata/modules"
+
+	tests := []struct {
+		name    string
+		wd      string
+		root    string
+		pkg     string
+		want    string
+		success bool
+	}{{
+		name:    "this module",
+		wd:      modules + "/quoted",
+		root:    ".",
+		pkg:     "example.com/quoted",
+		want:    ".",
+		success: true,
+	}, {
+		name:    "replaced module",
+		wd:      modules + "/replace",
+		root:    ".",
+		pkg:     "example.com/fn",
+		want:    "fn",
+		success: true,
+	}, {
+		name:    "workspace package",
+		wd:      modules + "/workspace",
+		root:    "./app",
+		pkg:     "example.com/fn/sub",
+		want:    "fn/sub",
+		success: true,
+	}, {
+		name: "other module",
+		wd:   modules + "/quoted",
+		root: ".",
+		pkg:  "example.com/fn",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := packageDir(test.wd, filepath.Join(test.wd, test.root), test.pkg)
+			if err != nil && test.success {
+				t.Fatal("Unexpected error:", err)
+			} else if err == nil && !test.success {
+				t.Fatal("Unexpected success:", got)
+			}
+			if !test.success {
+				return
+			}
+			if want := filepath.Join(test.wd, filepath.FromSlash(test.want)); got != want {
+				t.Errorf("packageDir() = %q, wanted %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRequiredVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		gomod string
+		want  string
+	}{{
+		name:  "required",
+		gomod: "module example.com/app\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n",
+		want:  "v2.3.1",
+	}, {
+		name:  "not required",
+		gomod: "module example.com/app\n",
+		want:  "",
+	}, {
+		name: "replaced by a directory",
+		gomod: "module example.com/app\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n\n" +
+			"replace github.com/cloudevents/sdk-go/v2 => ../sdk-go\n",
+		want: "v2.3.1 => ../sdk-go",
+	}, {
+		name: "replaced by a fork",
+		gomod: "module example.com/app\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n\n" +
+			"replace github.com/cloudevents/sdk-go/v2 v2.3.1 => example.com/fork/v2 v2.4.0\n",
+		want: "v2.3.1 => example.com/fork/v2 v2.4.0",
+	}, {
+		name: "other version replaced",
+		gomod: "module example.com/app\n\nrequire github.com/cloudevents/sdk-go/v2 v2.3.1\n\n" +
+			"replace github.com/cloudevents/sdk-go/v2 v2.0.0 => ../sdk-go\n",
+		want: "v2.3.1",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(test.gomod), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			m, err := readModule(dir)
+			if err != nil {
+				t.Fatal("readModule() =", err)
+			}
+			if got := m.requiredVersion(sdkModule); got != test.want {
+				t.Errorf("requiredVersion() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package function
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+// payloadArg and resultArg are placeholders in a signature for exported
+// struct types declared in the user's package.  The generated scaffolding
+// decodes the event's data into the payload, and encodes a returned result
+// as the data of the response event.
+var (
+	payloadArg = detect.FunctionArg{Name: "{payload}"}
+	resultArg  = detect.FunctionArg{Name: "{result}", Pointer: true}
+)
+
+// binding records the names of the user's types that are bound to the
+// placeholders of a signature.
+type binding struct {
+	Payload string
+	Result  string
+}
+
+// set binds the placeholder arg to the type name.
+func (b *binding) set(arg detect.FunctionArg, name string) {
+	if arg == payloadArg {
+		b.Payload = name
+	} else {
+		b.Result = name
+	}
+}
+
+// isPlaceholder returns whether arg is a placeholder for a user type.
+func isPlaceholder(arg detect.FunctionArg) bool {
+	return arg == payloadArg || arg == resultArg
+}
+
+// hasPlaceholders returns whether sig has arguments for user types.
+func hasPlaceholders(sig detect.FunctionSignature) bool {
+	for _, arg := range append(append([]detect.FunctionArg{}, sig.In...), sig.Out...) {
+		if isPlaceholder(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// structTypes returns the names of the exported struct types declared in
+// the files.
+func structTypes(files []*ast.File) map[string]bool {
+	structs := make(map[string]bool)
+	for _, f := range files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, ok := ts.Type.(*ast.StructType); ok && ts.Name.IsExported() && !ts.Assign.IsValid() {
+					structs[ts.Name.Name] = true
+				}
+			}
+		}
+	}
+	return structs
+}
+
+// bindArg matches the argument got, as written in source, against want.
+// When want is a placeholder, got must name one of the structs.
+func (b *binding) bindArg(got, want detect.FunctionArg, structs map[string]bool) bool {
+	if !isPlaceholder(want) {
+		return got == want
+	}
+	if got.ImportPath != "" || got.Pointer != want.Pointer || !structs[got.Name] {
+		return false
+	}
+	b.set(want, got.Name)
+	return true
+}
+
+// bindType matches the type t against the placeholder want, which must be
+// an exported struct type declared in pkg.
+func (b *binding) bindType(pkg *types.Package, t types.Type, want detect.FunctionArg) bool {
+	if want.Pointer {
+		p, ok := t.(*types.Pointer)
+		if !ok {
+			return false
+		}
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() != pkg || !named.Obj().Exported() {
+		return false
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	b.set(want, named.Obj().Name())
+	return true
+}
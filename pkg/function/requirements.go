@@ -0,0 +1,314 @@
+package function
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// RequirementsError reports the packages imported by the generated
+// scaffolding that the main module doesn't provide, along with the file and
+// commands that add them.
+type RequirementsError struct {
+	// Module is the path of the main module.
+	Module string
+
+	Problems []string
+
+	// Package is the name of the package in the main module's directory, and
+	// Imports holds the packages that a tools.go file in that package must
+	// import, as the scaffolding only exists at build time, and go mod tidy
+	// would otherwise drop their requirements.
+	Package string
+	Imports []string
+
+	Commands []string
+}
+
+// Error implements error.
+func (e *RequirementsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %q is missing requirements of the generated scaffolding:\n  %s\n",
+		e.Module, strings.Join(e.Problems, "\n  "))
+	if len(e.Imports) > 0 {
+		fmt.Fprintf(&b, "add the following tools.go to the module's directory, so that go mod tidy keeps them:\n\n%s\nand ",
+			e.ToolsFile())
+	}
+	fmt.Fprintf(&b, "run the following in the module's directory:\n  %s", strings.Join(e.Commands, "\n  "))
+	return b.String()
+}
+
+// ToolsFile returns the source of a file that imports Imports in the tools
+// build, which go mod tidy and go mod vendor consider, but go build doesn't.
+func (e *RequirementsError) ToolsFile() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "//go:build tools\n// +build tools\n\npackage %s\n\nimport (\n", e.Package)
+	for _, imp := range e.Imports {
+		fmt.Fprintf(&b, "\t_ %q\n", imp)
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// checkRequirements checks that the main module in moduleDir durably
+// provides the packages imported by the generated files.  The packages of
+// the CloudEvents SDK, which the scaffolding imports directly, must belong to
+// modules that it requires, and that its own source imports, or go mod tidy
+// would drop them.  The other packages, such as those of the protocols'
+// clients, are dependencies of the SDK's, so they only need to be in the
+// module graph: required by go.mod, or listed in go.sum, as go.mod only lists
+// indirect requirements since Go 1.17.  Their checksums must be listed in its
+// go.sum, or the packages in vendor/modules.txt when the module is vendored.
+// goflags holds the flags that the go command is run with.  In a go.work
+// workspace, the requirements may come from any module that it uses, and the
+// module graph and checksums from go.work.sum, so only the requirements of
+// the SDK's packages are checked.
+func checkRequirements(workingDir, moduleDir, goflags string, i *TemplateData, files []generatedFile) error {
+	mod, err := readModule(moduleDir)
+	if err != nil {
+		return err
+	}
+	modules := []*goModule{mod}
+	uses, err := workspaceUses(workingDir, moduleDir)
+	if err != nil {
+		return err
+	}
+	dirs := make([]string, 0, len(uses))
+	for dir := range uses {
+		if dir != mod.Dir {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		m, err := readModule(dir)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, m)
+	}
+
+	asts, err := parseGenerated(token.NewFileSet(), files)
+	if err != nil {
+		return err
+	}
+	pkgName, imported, err := sourceImports(modules)
+	if err != nil {
+		return err
+	}
+
+	var vendored map[string]bool
+	var sums map[string]bool
+	if uses == nil {
+		if vendored, err = vendoredPackages(mod, goflags); err != nil {
+			return err
+		}
+		if vendored == nil {
+			if sums, err = readSums(filepath.Join(moduleDir, "go.sum")); err != nil {
+				return err
+			}
+		}
+	}
+
+	e := &RequirementsError{Module: mod.Path(), Package: pkgName}
+	for _, imp := range generatedImports(asts) {
+		if isStandard(imp) || imp == i.Package {
+			continue
+		}
+		owner, req := provider(modules, imp)
+		direct := strings.HasPrefix(imp, sdkModules)
+		switch {
+		case owner != nil:
+			continue
+
+		case req == nil && direct:
+			e.Problems = append(e.Problems, fmt.Sprintf("no module in go.mod provides package %s", imp))
+			e.Imports = append(e.Imports, imp)
+			continue
+
+		case req != nil && direct && !imported[req.Mod.Path]:
+			e.Problems = append(e.Problems, fmt.Sprintf("no package of module %s is imported by the module's source, so go mod tidy drops the requirement that provides package %s", req.Mod.Path, imp))
+			e.Imports = append(e.Imports, imp)
+		}
+
+		switch {
+		case vendored != nil:
+			if !vendored[imp] {
+				e.Problems = append(e.Problems, fmt.Sprintf("package %s is missing from vendor/modules.txt", imp))
+			}
+
+		case sums != nil && req == nil:
+			if !summed(sums, imp) {
+				e.Problems = append(e.Problems, fmt.Sprintf("neither go.mod nor go.sum lists a module that provides package %s", imp))
+			}
+
+		case sums != nil:
+			m := mod.replacement(req.Mod.Path, req.Mod.Version)
+			if sum := m.Path + " " + m.Version; m.Version != "" && !sums[sum] {
+				// Report each missing checksum once.
+				sums[sum] = true
+				e.Problems = append(e.Problems, fmt.Sprintf("go.sum is missing the checksum of %s %s, which provides package %s", m.Path, m.Version, imp))
+			}
+		}
+	}
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	e.Commands = []string{"go mod tidy"}
+	if vendored != nil {
+		e.Commands = append(e.Commands, "go mod vendor")
+	}
+	return e
+}
+
+// sdkModules is the prefix of the paths of the CloudEvents SDK's modules,
+// including those of its protocol bindings.
+const sdkModules = "github.com/cloudevents/sdk-go/"
+
+// summed returns whether the go.sum checksums in sums, as returned by
+// readSums, list a module that provides the package imp.
+func summed(sums map[string]bool, imp string) bool {
+	for sum := range sums {
+		if inModule(imp, strings.Fields(sum)[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// provider returns the module among modules that contains the package imp,
+// if any, or else the requirement that provides it.
+func provider(modules []*goModule, imp string) (*goModule, *modfile.Require) {
+	var req *modfile.Require
+	for _, m := range modules {
+		if inModule(imp, m.Path()) {
+			return m, nil
+		}
+		if r := m.provider(imp); r != nil && (req == nil || len(r.Mod.Path) > len(req.Mod.Path)) {
+			req = r
+		}
+	}
+	return nil, req
+}
+
+// sourceImports parses the Go files of modules, whatever their build
+// constraints, as go mod tidy does, and returns the name of the package in
+// the directory of the first module ("tools" if it has none), along with the
+// paths of the required modules that they import packages from.
+func sourceImports(modules []*goModule) (string, map[string]bool, error) {
+	pkgName := "tools"
+	imported := make(map[string]bool)
+	fset := token.NewFileSet()
+	for n, m := range modules {
+		err := filepath.Walk(m.Dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if p == m.Dir {
+					return nil
+				}
+				// Skip the directories that the go command ignores, and
+				// nested modules.
+				if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return nil
+			}
+			f, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+			if err != nil {
+				return err
+			}
+			if n == 0 && filepath.Dir(p) == m.Dir && !strings.HasSuffix(name, "_test.go") {
+				pkgName = f.Name.Name
+			}
+			for _, spec := range f.Imports {
+				imp, err := strconv.Unquote(spec.Path.Value)
+				if err != nil || isStandard(imp) {
+					continue
+				}
+				if _, req := provider(modules, imp); req != nil {
+					imported[req.Mod.Path] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return pkgName, imported, nil
+}
+
+// isStandard returns whether the import path belongs to the standard
+// library, whose first path element has no dot.
+func isStandard(imp string) bool {
+	first := strings.SplitN(imp, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
+
+// readSums reads the modules whose checksums are listed in the go.sum file f,
+// as "path version", ignoring the checksums of go.mod files.
+func readSums(f string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]bool)
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 3 && !strings.HasSuffix(fields[1], "/go.mod") {
+			sums[fields[0]+" "+fields[1]] = true
+		}
+	}
+	return sums, nil
+}
+
+// vendoredPackages returns the packages listed in the vendor/modules.txt file
+// of the main module m, when the go command builds it in vendor mode, or nil
+// otherwise.  Since Go 1.14, vendor mode is the default for modules with a
+// vendor directory that declare go 1.14 or later, unless goflags sets -mod.
+func vendoredPackages(m *goModule, goflags string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(m.Dir, "vendor", "modules.txt"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if m.File.Go == nil || semver.Compare("v"+m.File.Go.Version, "v1.14") < 0 {
+		return nil, nil
+	}
+	for _, flag := range strings.Fields(goflags) {
+		if strings.HasPrefix(flag, "-mod=") && flag != "-mod=vendor" {
+			return nil, nil
+		}
+	}
+
+	pkgs := make(map[string]bool)
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			pkgs[line] = true
+		}
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,269 @@
+package function
+
+import (
+	"errors"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRequirements(t *testing.T) {
+	const (
+		sdk   = "github.com/cloudevents/sdk-go/v2"
+		kafka = "github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+		// sarama is a dependency of kafka, which go.mod only lists as
+		// indirect since Go 1.17.
+		sarama = "github.com/Shopify/sarama"
+		gomod  = "module example.com/app\n\ngo 1.14\n\nrequire " + sdk + " v2.3.1\n"
+		gosum  = sdk + " v2.3.1 h1:QRTu0yRA4FbznjRSds0/4Hy6cVYpWV2wInlNJSHWAtw=\n" +
+			sdk + " v2.3.1/go.mod h1:4fO2UjPMYYR1/7KPJQCwTPb0lFA8zYuitkUpAZFSY1Q=\n"
+		source   = "package app\n\nimport _ \"" + sdk + "\"\n"
+		vendored = "# " + sdk + " v2.3.1\n## explicit\n" + sdk + "\n" + sdk + "/client\n" + sdk + "/protocol\n" + sdk + "/protocol/http\n"
+	)
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		goflags string
+		imports []string
+		want    *RequirementsError
+	}{{
+		name:    "complete",
+		files:   map[string]string{"go.mod": gomod, "go.sum": gosum, "fn.go": source},
+		imports: []string{sdk, sdk + "/client", sdk + "/protocol/http", "example.com/app/fn"},
+	}, {
+		name:    "missing requirement",
+		files:   map[string]string{"go.mod": gomod, "go.sum": gosum, "fn.go": source},
+		imports: []string{sdk, kafka},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"no module in go.mod provides package " + kafka},
+			Package:  "app",
+			Imports:  []string{kafka},
+			Commands: []string{"go mod tidy"},
+		},
+	}, {
+		name: "requirement not imported",
+		files: map[string]string{
+			"go.mod": gomod + "require " + kafka + " v2.3.1\n",
+			"go.sum": gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n",
+			"fn.go":  source,
+		},
+		imports: []string{sdk, kafka},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"no package of module " + kafka + " is imported by the module's source, so go mod tidy drops the requirement that provides package " + kafka},
+			Package:  "app",
+			Imports:  []string{kafka},
+			Commands: []string{"go mod tidy"},
+		},
+	}, {
+		name: "imported by tools.go",
+		files: map[string]string{
+			"go.mod":   gomod + "require " + kafka + " v2.3.1\n",
+			"go.sum":   gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n",
+			"fn.go":    source,
+			"tools.go": "//go:build tools\n\npackage app\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka},
+	}, {
+		name: "imported by a nested module",
+		files: map[string]string{
+			"go.mod":             gomod + "require " + kafka + " v2.3.1\n",
+			"go.sum":             gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n",
+			"fn.go":              source,
+			"nested/go.mod":      "module example.com/app/nested\n",
+			"nested/nested.go":   "package nested\n\nimport _ \"" + kafka + "\"\n",
+			"testdata/data.go":   "package data\n\nimport _ \"" + kafka + "\"\n",
+			"vendor/vendored.go": "package vendored\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"no package of module " + kafka + " is imported by the module's source, so go mod tidy drops the requirement that provides package " + kafka},
+			Package:  "app",
+			Imports:  []string{kafka},
+			Commands: []string{"go mod tidy"},
+		},
+	}, {
+		name: "dependency in go.sum",
+		files: map[string]string{
+			"go.mod":   gomod + "require " + kafka + " v2.3.1\n",
+			"go.sum":   gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n" + sarama + " v1.19.0 h1:9oksLxC6uxVPHPVYUmq6xhr1BOF/hHobWH2UzO67z1s=\n",
+			"fn.go":    source,
+			"tools.go": "//go:build tools\n\npackage app\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka, sarama},
+	}, {
+		name: "indirect dependency in go.mod",
+		files: map[string]string{
+			"go.mod":   gomod + "require " + kafka + " v2.3.1\nrequire " + sarama + " v1.19.0 // indirect\n",
+			"go.sum":   gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n" + sarama + " v1.19.0 h1:9oksLxC6uxVPHPVYUmq6xhr1BOF/hHobWH2UzO67z1s=\n",
+			"fn.go":    source,
+			"tools.go": "//go:build tools\n\npackage app\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka, sarama},
+	}, {
+		name: "dependency missing from the module graph",
+		files: map[string]string{
+			"go.mod":   gomod + "require " + kafka + " v2.3.1\n",
+			"go.sum":   gosum + kafka + " v2.3.1 h1:BcxVMrCXJxJ8J9ahzzkqNcvBO6mN0bVbkKJVzTvaIEw=\n",
+			"fn.go":    source,
+			"tools.go": "//go:build tools\n\npackage app\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka, sarama},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"neither go.mod nor go.sum lists a module that provides package " + sarama},
+			Package:  "app",
+			Commands: []string{"go mod tidy"},
+		},
+	}, {
+		name:    "missing checksum",
+		files:   map[string]string{"go.mod": gomod, "fn/fn.go": source},
+		imports: []string{sdk, sdk + "/protocol/http"},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"go.sum is missing the checksum of " + sdk + " v2.3.1, which provides package " + sdk},
+			Package:  "tools",
+			Commands: []string{"go mod tidy"},
+		},
+	}, {
+		name: "replaced by a directory",
+		files: map[string]string{
+			"go.mod": gomod + "\nreplace " + sdk + " => ../sdk-go\n",
+			"fn.go":  source,
+		},
+		imports: []string{sdk},
+	}, {
+		name: "vendored",
+		files: map[string]string{
+			"go.mod":             gomod,
+			"fn.go":              source,
+			"vendor/modules.txt": vendored,
+		},
+		imports: []string{sdk, sdk + "/client", sdk + "/protocol/http"},
+	}, {
+		name: "missing from vendor",
+		files: map[string]string{
+			"go.mod":             gomod,
+			"fn.go":              source,
+			"vendor/modules.txt": "# " + sdk + " v2.3.1\n## explicit\n" + sdk + "\n",
+		},
+		imports: []string{sdk, sdk + "/protocol/http"},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"package " + sdk + "/protocol/http is missing from vendor/modules.txt"},
+			Package:  "app",
+			Commands: []string{"go mod tidy", "go mod vendor"},
+		},
+	}, {
+		name: "vendor disabled",
+		files: map[string]string{
+			"go.mod":             gomod,
+			"go.sum":             gosum,
+			"fn.go":              source,
+			"vendor/modules.txt": "# " + sdk + " v2.3.1\n",
+		},
+		goflags: "-tags=http -mod=mod",
+		imports: []string{sdk, sdk + "/protocol/http"},
+	}, {
+		name: "vendor before go 1.14",
+		files: map[string]string{
+			"go.mod":             "module example.com/app\n\ngo 1.13\n\nrequire " + sdk + " v2.3.1\n",
+			"go.sum":             gosum,
+			"fn.go":              source,
+			"vendor/modules.txt": "# " + sdk + " v2.3.1\n",
+		},
+		imports: []string{sdk},
+	}, {
+		name: "workspace",
+		files: map[string]string{
+			"go.mod":         gomod,
+			"fn.go":          source,
+			"go.work":        "go 1.18\n\nuse (\n\t.\n\t./other\n)\n",
+			"other/go.mod":   "module example.com/other\n\ngo 1.18\n\nrequire " + kafka + " v2.3.1\n",
+			"other/other.go": "package other\n\nimport _ \"" + kafka + "\"\n",
+		},
+		imports: []string{sdk, kafka, "example.com/other"},
+	}, {
+		name: "workspace without the requirement",
+		files: map[string]string{
+			"go.mod":       gomod,
+			"fn.go":        source,
+			"go.work":      "go 1.18\n\nuse (\n\t.\n\t./other\n)\n",
+			"other/go.mod": "module example.com/other\n\ngo 1.18\n",
+		},
+		imports: []string{sdk, kafka},
+		want: &RequirementsError{
+			Module:   "example.com/app",
+			Problems: []string{"no module in go.mod provides package " + kafka},
+			Package:  "app",
+			Imports:  []string{kafka},
+			Commands: []string{"go mod tidy"},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				p := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+					t.Fatal("MkdirAll() =", err)
+				}
+				if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+			src := "package main\n\nimport (\n\t\"context\"\n"
+			for _, imp := range test.imports {
+				src += "\t_ \"" + imp + "\"\n"
+			}
+			src += ")\n"
+			files := []generatedFile{{Name: "main.go", Source: []byte(src)}}
+
+			err := checkRequirements(dir, dir, test.goflags, &TemplateData{Package: "example.com/app/fn"}, files)
+			var got *RequirementsError
+			if err != nil && !errors.As(err, &got) {
+				t.Fatal("checkRequirements() =", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("checkRequirements() = %#v, wanted %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequirementsErrorToolsFile(t *testing.T) {
+	e := &RequirementsError{
+		Module:   "example.com/app",
+		Problems: []string{"no module in go.mod provides package github.com/nats-io/nats.go"},
+		Package:  "app",
+		Imports:  []string{"github.com/cloudevents/sdk-go/protocol/nats/v2", "github.com/nats-io/nats.go"},
+		Commands: []string{"go mod tidy"},
+	}
+	want := `//go:build tools
+// +build tools
+
+package app
+
+import (
+	_ "github.com/cloudevents/sdk-go/protocol/nats/v2"
+	_ "github.com/nats-io/nats.go"
+)
+`
+	if got := e.ToolsFile(); got != want {
+		t.Errorf("ToolsFile() = %q, wanted %q", got, want)
+	}
+	if src, err := format.Source([]byte(want)); err != nil || string(src) != want {
+		t.Errorf("format.Source() = %q, %v", src, err)
+	}
+	if !strings.Contains(e.Error(), want+"\nand run the following in the module's directory:\n  go mod tidy") {
+		t.Errorf("Error() = %q, wanted it to hold the tools.go file and the commands", e.Error())
+	}
+}
@@ -0,0 +1,146 @@
+package function
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestProtocolScaffolding builds the scaffolding of each protocol into a
+// module of testdata, and runs the module's tests.  It downloads the modules
+// that the test modules require, so it only runs when SCAFFOLDING_TESTS is
+// set, as in the e2e workflow.
+func TestProtocolScaffolding(t *testing.T) {
+	if os.Getenv("SCAFFOLDING_TESTS") == "" {
+		t.Skip("set SCAFFOLDING_TESTS=1 to run the scaffolding against in-process brokers")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	sigs, err := loadSignatures("../../buildpacks/signatures.json")
+	if err != nil {
+		t.Fatal("loadSignatures() =", err)
+	}
+
+	// Each module holds a function, and tests of the command package, which
+	// run it against an in-process broker where there is one.
+	tests := []struct {
+		name      string
+		protocol  string
+		function  string
+		signature string
+		run       string
+	}{{
+		name:      "kafka",
+		protocol:  "kafka",
+		function:  "Receive",
+		signature: "func(context.Context, cloudevents.Event) error",
+		run:       "TestMockBroker",
+	}, {
+		name:      "kafka max retries",
+		protocol:  "kafka",
+		function:  "Receive",
+		signature: "func(context.Context, cloudevents.Event) error",
+		run:       "TestMaxRetries",
+	}, {
+		name:      "nats",
+		protocol:  "nats",
+		function:  "Handle",
+		signature: "func(context.Context, cloudevents.Event) (*cloudevents.Event, error)",
+		run:       "TestCore",
+	}, {
+		name:      "nats jetstream",
+		protocol:  "nats",
+		function:  "Handle",
+		signature: "func(context.Context, cloudevents.Event) (*cloudevents.Event, error)",
+		run:       "TestJetStream",
+	}, {
+		name:      "amqp",
+		protocol:  "amqp",
+		function:  "Receive",
+		signature: "func(context.Context, cloudevents.Event) error",
+	}, {
+		name:      "mqtt",
+		protocol:  "mqtt",
+		function:  "Handle",
+		signature: "func(context.Context, cloudevents.Event) (*cloudevents.Event, error)",
+	}, {
+		name:      "pubsub",
+		protocol:  "pubsub",
+		function:  "Handle",
+		signature: "func(context.Context, cloudevents.Event) (*cloudevents.Event, error)",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sig signature
+			for _, s := range sigs[test.protocol] {
+				if formatSignature(s.FunctionSignature) == test.signature {
+					sig = s
+				}
+			}
+
+			dir := t.TempDir()
+			if err := copyTree(filepath.Join("testdata", test.protocol), dir); err != nil {
+				t.Fatal("copyTree() =", err)
+			}
+			i := &TemplateData{
+				ModuleRoot: ".",
+				Package:    "example.com/" + test.protocol + "/fn",
+				Protocol:   test.protocol,
+				Route: Route{
+					Function: test.function,
+					Native:   sig.Native,
+					Adapter:  sig.Adapter,
+				},
+			}
+			templates, err := loadTemplates("", "", test.protocol)
+			if err != nil {
+				t.Fatal("loadTemplates() =", err)
+			}
+			files, err := generate(i, templates)
+			if err != nil {
+				t.Fatal("generate() =", err)
+			}
+			for _, f := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, targetPackage, f.Name), f.Source, 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+
+			args := []string{"test", "-count=1", "-tags=" + test.protocol}
+			if test.run != "" {
+				args = append(args, "-run=^"+test.run+"$")
+			}
+			cmd := exec.Command("go", append(args, targetPackage)...)
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("go test = %v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// copyTree copies the files under src to dst.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0644)
+	})
+}
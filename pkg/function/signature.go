@@ -0,0 +1,135 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+//go:generate go run gen_signatures.go
+
+// signaturesFile is the name of the file shipped in the buildpack that holds
+// the supported signatures.
+const signaturesFile = "signatures.json"
+
+// signature is a supported function signature, along with the scaffolding
+// that adapts functions with that signature to a CloudEvents receiver.
+// Signature files map protocol names to lists of signatures, which are
+// matched in order.
+type signature struct {
+	detect.FunctionSignature
+
+	// Native is set when client.StartReceiver accepts functions with the
+	// signature as they are, so that they need no adapter unless events
+	// are filtered.
+	Native bool `json:"native,omitempty"`
+
+	// Imports holds the import paths of the packages that the adapter uses,
+	// besides context, cloudevents and protocol.
+	Imports []string `json:"imports,omitempty"`
+
+	// Adapter is the body of a func(ctx context.Context, event
+	// cloudevents.Event) (*cloudevents.Event, protocol.Result), which calls
+	// the user's function fn and returns its response.  It is a
+	// text/template, which is executed with the function's route, and may
+	// refer to the user's package as p.
+	Adapter string `json:"adapter"`
+}
+
+// loadSignatures reads the signatures in the file f.
+func loadSignatures(f string) (map[string][]signature, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return parseSignatures(f, data)
+}
+
+// parseSignatures parses the signatures in data, which was read from f.  The
+// signatures are keyed by a protocol, or by a comma-separated list of the
+// protocols that share them.
+func parseSignatures(f string, data []byte) (map[string][]signature, error) {
+	var lists map[string][]signature
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, fmt.Errorf("%s: %w", f, err)
+	}
+	sigs := make(map[string][]signature, len(lists))
+	for key, list := range lists {
+		for i := range list {
+			if err := list[i].validate(); err != nil {
+				return nil, fmt.Errorf("%s: %s signature #%d: %w", f, key, i+1, err)
+			}
+		}
+		for _, protocol := range strings.Split(key, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if _, ok := sigs[protocol]; ok {
+				return nil, fmt.Errorf("%s: the signatures of %s are listed more than once", f, protocol)
+			}
+			sigs[protocol] = list
+		}
+	}
+	return sigs, nil
+}
+
+// validate checks that the signature is well-formed.
+func (s *signature) validate() error {
+	for _, arg := range append(append([]detect.FunctionArg{}, s.In...), s.Out...) {
+		if arg.Name == "" {
+			return fmt.Errorf("argument %q is missing a type name", arg.String())
+		}
+	}
+	if strings.TrimSpace(s.Adapter) == "" {
+		return fmt.Errorf("%s is missing an adapter", s.String())
+	}
+	if _, err := template.New("adapter").Parse(s.Adapter); err != nil {
+		return fmt.Errorf("%s has a malformed adapter: %w", s.String(), err)
+	}
+	return nil
+}
+
+// signatures loads the signatures shipped in the buildpack in cnbPath, or the
+// built-in copy of them when cnbPath is empty, and those in SignaturesFile
+// (relative to the application directory), which take precedence.
+func (d *Detector) signatures(cnbPath, workingDir string) (map[string][]signature, error) {
+	var sigs map[string][]signature
+	var err error
+	if cnbPath == "" {
+		sigs, err = parseSignatures("built-in "+signaturesFile, []byte(builtinSignatures))
+	} else {
+		sigs, err = loadSignatures(filepath.Join(cnbPath, signaturesFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.SignaturesFile == "" {
+		return sigs, nil
+	}
+	p := d.SignaturesFile
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(workingDir, p)
+	}
+	extra, err := loadSignatures(p)
+	if err != nil {
+		return nil, err
+	}
+	// The extra signatures are copied, so that prepending them to the
+	// shipped ones never writes into a list that another protocol holds.
+	for protocol, list := range extra {
+		sigs[protocol] = append(append([]signature{}, list...), sigs[protocol]...)
+	}
+	return sigs, nil
+}
+
+// functionSignatures returns the function signatures of sigs.
+func functionSignatures(sigs []signature) []detect.FunctionSignature {
+	fs := make([]detect.FunctionSignature, 0, len(sigs))
+	for _, sig := range sigs {
+		fs = append(fs, sig.FunctionSignature)
+	}
+	return fs
+}
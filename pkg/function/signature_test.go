@@ -0,0 +1,252 @@
+package function
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/paketo-buildpacks/packit"
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+func TestShippedSignatures(t *testing.T) {
+	sigs, err := loadSignatures("../../buildpacks/signatures.json")
+	if err != nil {
+		t.Fatal("loadSignatures() =", err)
+	}
+	if got, want := len(sigs["http"]), 14; got != want {
+		t.Errorf("len(http) = %d, wanted %d", got, want)
+	}
+	for _, protocol := range []string{"kafka", "nats", "amqp", "mqtt", "pubsub"} {
+		if got, want := len(sigs[protocol]), len(sigs["http"]); got != want {
+			t.Errorf("len(%s) = %d, wanted %d", protocol, got, want)
+		}
+		if _, ok := templateSources[protocol]; !ok {
+			t.Errorf("protocol %s has no template", protocol)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, sig := range sigs["http"] {
+		if seen[sig.String()] {
+			t.Errorf("signature %s appears more than once", sig.String())
+		}
+		seen[sig.String()] = true
+		if sig.Native == hasPlaceholders(sig.FunctionSignature) {
+			t.Errorf("signature %s: native = %v", sig.String(), sig.Native)
+		}
+	}
+}
+
+func TestBuiltinSignatures(t *testing.T) {
+	data, err := ioutil.ReadFile("../../buildpacks/signatures.json")
+	if err != nil {
+		t.Fatal("ReadFile() =", err)
+	}
+	if string(data) != builtinSignatures {
+		t.Error("builtinSignatures is out of date, run `go generate ./pkg/function`")
+	}
+}
+
+func TestParseSignatures(t *testing.T) {
+	const sig = `{"in": [{"importPath": "github.com/cloudevents/sdk-go/v2", "name": "Event"}], "adapter": "return nil, fn(event)"}`
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]int
+		wantErr string
+	}{{
+		name: "single protocol",
+		data: `{"http": [` + sig + `]}`,
+		want: map[string]int{"http": 1},
+	}, {
+		name: "shared signatures",
+		data: `{"http, kafka": [` + sig + `, ` + sig + `], "nats": [` + sig + `]}`,
+		want: map[string]int{"http": 2, "kafka": 2, "nats": 1},
+	}, {
+		name:    "protocol listed twice",
+		data:    `{"http,kafka": [` + sig + `], "kafka": [` + sig + `]}`,
+		wantErr: "the signatures of kafka are listed more than once",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sigs, err := parseSignatures("signatures.json", []byte(test.data))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseSignatures() = %v, wanted %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("parseSignatures() =", err)
+			}
+			got := make(map[string]int, len(sigs))
+			for protocol, list := range sigs {
+				got[protocol] = len(list)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Error("signatures (-want, +got):", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	event := detect.FunctionArg{ImportPath: "github.com/cloudevents/sdk-go/v2", Name: "Event"}
+
+	tests := []struct {
+		name    string
+		sig     signature
+		success bool
+	}{{
+		name: "valid",
+		sig: signature{
+			FunctionSignature: detect.FunctionSignature{In: []detect.FunctionArg{event}},
+			Adapter:           "fn(event)\nreturn nil, nil",
+		},
+		success: true,
+	}, {
+		name: "missing adapter",
+		sig: signature{
+			FunctionSignature: detect.FunctionSignature{In: []detect.FunctionArg{event}},
+		},
+	}, {
+		name: "malformed adapter",
+		sig: signature{
+			FunctionSignature: detect.FunctionSignature{In: []detect.FunctionArg{event}},
+			Adapter:           "var data p.{{.Payload",
+		},
+	}, {
+		name: "missing type name",
+		sig: signature{
+			FunctionSignature: detect.FunctionSignature{In: []detect.FunctionArg{{ImportPath: "context"}}},
+			Adapter:           "return nil, nil",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.sig.validate()
+			if test.success && err != nil {
+				t.Errorf("validate() = %v", err)
+			} else if !test.success && err == nil {
+				t.Error("validate() = nil, wanted error")
+			}
+		})
+	}
+}
+
+func TestSignaturesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		match   bool
+		adapter string
+	}{{
+		name: "shipped signatures",
+	}, {
+		name:    "house signatures",
+		file:    "pkg/function/testdata/house/signatures.json",
+		match:   true,
+		adapter: "return nil, fn(ctx, &event)",
+	}, {
+		name: "malformed signatures",
+		file: "pkg/function/testdata/house/bad.json",
+	}, {
+		name: "missing signatures",
+		file: "pkg/function/testdata/house/missing.json",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := Detector{
+				ModuleRoot:     ".",
+				Package:        "./pkg/function/testdata/house",
+				Protocol:       "http",
+				SignaturesFile: test.file,
+			}
+			p, err := d.Detect(packit.DetectContext{
+				WorkingDir: "../../",
+				CNBPath:    cnbPath,
+			})
+			if err != nil && test.match {
+				t.Fatal("Unexpected error:", err)
+			} else if err == nil && !test.match {
+				t.Fatal("Unexpected match:", p)
+			}
+			if err != nil {
+				return
+			}
+
+			md := p.Plan.Requires[0].Metadata.(map[string]interface{})
+			if got := md["adapter"]; got != test.adapter {
+				t.Errorf("adapter = %v, wanted %q", got, test.adapter)
+			}
+			if got, _ := md["native"].(bool); got {
+				t.Error("native = true, wanted false")
+			}
+		})
+	}
+}
+
+func TestMergeSignatures(t *testing.T) {
+	sig := func(adapter string) string {
+		return `{"in": [{"importPath": "github.com/cloudevents/sdk-go/v2", "name": "Event"}], "adapter": "` + adapter + `"}`
+	}
+
+	tests := []struct {
+		name    string
+		shipped string
+		extra   string
+		want    map[string][]string
+	}{{
+		name:    "extra signatures first",
+		shipped: `{"http": [` + sig("return shipped") + `]}`,
+		extra:   `{"http": [` + sig("return extra") + `]}`,
+		want:    map[string][]string{"http": {"return extra", "return shipped"}},
+	}, {
+		name:    "protocol without shipped signatures",
+		shipped: `{"http": [` + sig("return shipped") + `]}`,
+		extra:   `{"kafka": [` + sig("return extra") + `]}`,
+		want:    map[string][]string{"http": {"return shipped"}, "kafka": {"return extra"}},
+	}, {
+		name:    "extra signatures shared by protocols",
+		shipped: `{"http": [` + sig("return http") + `], "kafka": [` + sig("return kafka") + `]}`,
+		// The decoded list has room for one more signature, which a merge
+		// without copying would fill in for both protocols.
+		extra: `{"http,kafka": [` + sig("return 1") + `, ` + sig("return 2") + `, ` + sig("return 3") + `]}`,
+		want: map[string][]string{
+			"http":  {"return 1", "return 2", "return 3", "return http"},
+			"kafka": {"return 1", "return 2", "return 3", "return kafka"},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, signaturesFile), []byte(test.shipped), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "extra.json"), []byte(test.extra), 0644); err != nil {
+				t.Fatal("WriteFile() =", err)
+			}
+			d := Detector{SignaturesFile: "extra.json"}
+			sigs, err := d.signatures(dir, dir)
+			if err != nil {
+				t.Fatal("signatures() =", err)
+			}
+			got := make(map[string][]string, len(sigs))
+			for protocol, list := range sigs {
+				for _, sig := range list {
+					got[protocol] = append(got[protocol], sig.Adapter)
+				}
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Error("signatures (-want, +got):", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
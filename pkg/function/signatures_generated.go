@@ -0,0 +1,273 @@
+// Code generated by gen_signatures.go. DO NOT EDIT.
+
+package function
+
+// builtinSignatures holds the contents of the buildpack's signatures.json.
+const builtinSignatures = `{
+  "http,kafka,nats,amqp,mqtt,pubsub": [
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "native": true,
+      "adapter": "fn(event)\nreturn nil, nil"
+    },
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2/protocol",
+          "name": "Result"
+        }
+      ],
+      "native": true,
+      "adapter": "return nil, fn(event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "name": "error"
+        }
+      ],
+      "native": true,
+      "adapter": "return nil, fn(event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "native": true,
+      "adapter": "fn(ctx, event)\nreturn nil, nil"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2/protocol",
+          "name": "Result"
+        }
+      ],
+      "native": true,
+      "adapter": "return nil, fn(ctx, event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "name": "error"
+        }
+      ],
+      "native": true,
+      "adapter": "return nil, fn(ctx, event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(event), nil"
+    },
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2/protocol",
+          "name": "Result"
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        },
+        {
+          "name": "error"
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(ctx, event), nil"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2/protocol",
+          "name": "Result"
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(ctx, event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event"
+        }
+      ],
+      "out": [
+        {
+          "importPath": "github.com/cloudevents/sdk-go/v2",
+          "name": "Event",
+          "pointer": true
+        },
+        {
+          "name": "error"
+        }
+      ],
+      "native": true,
+      "adapter": "return fn(ctx, event)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "name": "{payload}"
+        }
+      ],
+      "out": [
+        {
+          "name": "error"
+        }
+      ],
+      "adapter": "var data p.{{.Payload}}\nif err := event.DataAs(&data); err != nil {\n\treturn nil, badRequest(err)\n}\nreturn nil, fn(ctx, data)"
+    },
+    {
+      "in": [
+        {
+          "importPath": "context",
+          "name": "Context"
+        },
+        {
+          "name": "{payload}"
+        }
+      ],
+      "out": [
+        {
+          "name": "{result}",
+          "pointer": true
+        },
+        {
+          "name": "error"
+        }
+      ],
+      "imports": [
+        "fmt"
+      ],
+      "adapter": "var data p.{{.Payload}}\nif err := event.DataAs(&data); err != nil {\n\treturn nil, badRequest(err)\n}\n\nresult, err := fn(ctx, data)\nif err != nil || result == nil {\n\treturn nil, err\n}\n\n// Respond with an event derived from the incoming event, which\n// carries the encoded result.\nresponse := cloudevents.NewEvent()\nresponse.SetType(event.Type() + \".response\")\nresponse.SetSource(event.Source())\nif err := response.SetData(cloudevents.ApplicationJSON, result); err != nil {\n\treturn nil, fmt.Errorf(\"failed to encode response: %w\", err)\n}\nreturn &response, nil"
+    }
+  ]
+}
+`
@@ -1,22 +1,42 @@
 package function
 
-import "text/template"
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
 
 const packageMain = `
 package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+{{- range .Imports}}
+	{{printf "%q" .}}
+{{- end}}
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+{{- if .Filters}}
+	"path"
+{{- end}}
 	"syscall"
 	"time"
-
+{{if or .Adapted .Routes}}
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+{{end}}
         p "{{.Package}}"
 )
 
 func main() {
+	log.Printf("Starting the function: %s", buildVersion())
+
 	// When we get a SIGTERM, cancel the first context and start to fail
 	// readiness probes.  After a suitable grace period for the container
 	// runtime to redirect network traffic (due to the failing probes),
@@ -36,11 +56,187 @@ func main() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+{{- if .Routes}}
+{{- if .Constructors}}
+
+	// Construct the receivers with a context that outlives the draining of
+	// outstanding requests.
+{{- range .Constructors}}
+	{{.Receiver}}, err := p.{{.Constructor}}(ctx2)
+	if err != nil {
+		log.Fatal(err)
+	}
+{{- end}}
+{{- end}}
+
+{{- range $i, $r := .Routes}}
+
+	// Adapt {{.Function}} to the signature of a CloudEvents receiver.
+	receive{{$i}} := func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, protocol.Result) {
+{{- if .Constructor}}
+		fn := {{.Receiver}}.{{.Method}}
+{{- else}}
+		fn := p.{{.Function}}
+{{- end}}
+{{- template "call" .}}
+	}
+{{- end}}
+
+	// Route each event to the first function that accepts it.
+	routes := []route{
+{{- range $i, $r := .Routes}}
+		{filter: {{template "filter" .}}, function: {{printf "%q" .Function}}, receive: receive{{$i}}},
+{{- end}}
+	}
+	for _, r := range routes {
+		log.Printf("Routing events of type %v from source %q to %s", r.types, r.source, r.function)
+	}
+	receive := func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, protocol.Result) {
+		for _, r := range routes {
+			if r.matches(event) {
+				return r.receive(ctx, event)
+			}
+		}
+		return nil, noHandler(event)
+	}
+
+	if err := client.StartReceiver(ctx2, receive); err != nil {
+		log.Fatal(err)
+	}
+{{- else}}
+{{- if .Constructor}}
+
+	// Construct the receiver with a context that outlives the draining of
+	// outstanding requests.
+	receiver, err := p.{{.Constructor}}(ctx2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fn := receiver.{{.Method}}
+{{- else}}
+
+	fn := p.{{.Function}}
+{{- end}}
+
+{{- if .Adapted}}
+{{- if .Filtered}}
+
+	// Only pass the events that the function accepts.
+	accepted := {{template "filter" .}}
+{{- end}}
+
+	// Adapt the function to the signature of a CloudEvents receiver.
+	receive := func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, protocol.Result) {
+{{- if .Filtered}}
+		if !accepted.matches(event) {
+			return nil, noHandler(event)
+		}
+{{- end}}
+{{- template "call" .}}
+	}
+
+	if err := client.StartReceiver(ctx2, receive); err != nil {
+		log.Fatal(err)
+	}
+{{- else}}
+
+	if err := client.StartReceiver(ctx2, fn); err != nil {
+		log.Fatal(err)
+	}
+{{- end}}
+{{- end}}
+}
+
+// buildInfo describes the function and its build as base64-encoded JSON, and
+// is stamped by the buildpack with -ldflags -X.
+var buildInfo string
+
+// buildVersion returns the JSON description of the function and its build.
+func buildVersion() []byte {
+	data, err := base64.RawURLEncoding.DecodeString(buildInfo)
+	if err != nil || !json.Valid(data) {
+		return []byte("{}")
+	}
+	return data
+}
 
-	if err := client.StartReceiver(ctx2, p.{{.Function}}); err != nil {
+// versionHandler serves the description of the function and its build.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buildVersion())
+}
+
+// serveAdmin serves the description of the function and its build at
+// /version on $PORT, if set, for the protocols that aren't served over HTTP.
+// Other paths pass readiness probes until ctx is cancelled.
+func serveAdmin(ctx context.Context) {
+	port := os.Getenv("PORT")
+	if port == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", versionHandler)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-ctx.Done():
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	if err := http.ListenAndServe(":"+port, mux); err != nil {
 		log.Fatal(err)
 	}
 }
+{{- if .Filters}}
+
+// filter selects events by their type and source.
+type filter struct {
+	// types holds patterns of the accepted event types, as for path.Match,
+	// or nil to accept any type.
+	types []string
+	// source holds the accepted event source, or "" to accept any source.
+	source string
+}
+
+// matches returns whether the filter accepts the event.
+func (f filter) matches(event cloudevents.Event) bool {
+	if f.source != "" && event.Source() != f.source {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, pattern := range f.types {
+		if ok, _ := path.Match(pattern, event.Type()); ok {
+			return true
+		}
+	}
+	return false
+}
+{{- end}}
+{{- if .Routes}}
+
+// route passes the events that match its filter to a function.
+type route struct {
+	filter
+	function string
+	receive  func(context.Context, cloudevents.Event) (*cloudevents.Event, protocol.Result)
+}
+{{- end}}
+`
+
+// templateHelpers defines the templates that the scaffolding templates,
+// including those in CE_TEMPLATE_DIR, may invoke: "filter" renders the
+// filter of a Route, and "call" renders the body of its adapter.
+const templateHelpers = `
+{{- define "filter" -}}
+filter{
+{{- if .Types}}types: []string{ {{- range $i, $t := .Types}}{{if $i}}, {{end}}{{printf "%q" $t}}{{end -}} }{{end}}
+{{- if and .Types .Source}}, {{end}}
+{{- if .Source}}source: {{printf "%q" .Source}}{{end -}} }
+{{- end}}
+{{- define "call"}}{{.Call}}{{end}}
 `
 
 const protocolHTTP = `
@@ -50,7 +246,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
@@ -82,16 +281,1468 @@ func probe(ctx context.Context) http.HandlerFunc {
 	}
 }
 
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return cehttp.NewResult(http.StatusBadRequest, "failed to decode event data: %v", err)
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return cehttp.NewResult(http.StatusBadRequest, "no handler for event type %q", event.Type())
+}
+
 func newClient(ctx context.Context) (cloudevents.Client, error) {
-	p, err := cehttp.New(cehttp.WithGetHandlerFunc(probe(ctx)))
+	opts := []cehttp.Option{cehttp.WithGetHandlerFunc(probe(ctx)){{if .Path}}, cehttp.WithPath({{printf "%q" .Path}}){{end}}}
+	// Listen on $PORT when it is set, as on Knative, rather than on 8080.
+	if env := os.Getenv("PORT"); env != "" {
+		port, err := strconv.Atoi(env)
+		if err != nil {
+			return nil, fmt.Errorf("malformed PORT %q: %w", env, err)
+		}
+		opts = append(opts, cehttp.WithPort(port))
+	}
+	p, err := cehttp.New(opts...)
 	if err != nil {
 		return nil, err
 	}
+
+	// Describe the function and its build at /version.
+	p.Handler = http.NewServeMux()
+	p.Handler.HandleFunc("/version", versionHandler)
 	return ceclient.NewObserved(p, ceclient.WithTimeNow(), ceclient.WithUUIDs())
 }
 `
 
-var templates = map[string]*template.Template{
-	"main": template.Must(template.New("ce-go-function-main").Parse(packageMain)),
-	"http": template.Must(template.New("ce-go-function-main").Parse(protocolHTTP)),
+const protocolKafka = `
+// +build kafka
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	ceclient "github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+// permanentError is the result for an event that retrying cannot help, which
+// is skipped rather than redelivered.
+type permanentError struct {
+	error
+}
+
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return permanentError{fmt.Errorf("failed to decode event data: %w", err)}
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return permanentError{fmt.Errorf("no handler for event type %q", event.Type())}
+}
+
+// env returns the comma-separated list in the environment variable.
+func env(name string) []string {
+	var list []string
+	for _, s := range strings.Split(os.Getenv(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// kafkaConfig returns the configuration of the Kafka client, from the
+// CE_KAFKA_* environment variables.
+func kafkaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	version := os.Getenv("CE_KAFKA_VERSION")
+	if version == "" {
+		version = "2.0.0"
+	}
+	v, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("malformed CE_KAFKA_VERSION: %w", err)
+	}
+	config.Version = v
+
+	switch offset := os.Getenv("CE_KAFKA_INITIAL_OFFSET"); offset {
+	case "", "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, fmt.Errorf("CE_KAFKA_INITIAL_OFFSET must be newest or oldest, got %q", offset)
+	}
+
+	// SASL/PLAIN is the only mechanism that sarama supports without further
+	// dependencies, such as a SCRAM client.
+	if mechanism := os.Getenv("CE_KAFKA_SASL_MECHANISM"); mechanism != "" && mechanism != sarama.SASLTypePlaintext {
+		return nil, fmt.Errorf("CE_KAFKA_SASL_MECHANISM must be %s, the only supported SASL mechanism, got %q", sarama.SASLTypePlaintext, mechanism)
+	}
+	if user := os.Getenv("CE_KAFKA_SASL_USER"); user != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		config.Net.SASL.User = user
+		config.Net.SASL.Password = os.Getenv("CE_KAFKA_SASL_PASSWORD")
+	}
+
+	ca, cert, key := os.Getenv("CE_KAFKA_TLS_CA_FILE"), os.Getenv("CE_KAFKA_TLS_CERT_FILE"), os.Getenv("CE_KAFKA_TLS_KEY_FILE")
+	if os.Getenv("CE_KAFKA_TLS") == "true" || ca != "" || cert != "" {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = &tls.Config{}
+		if ca != "" {
+			pem, err := ioutil.ReadFile(ca)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in CE_KAFKA_TLS_CA_FILE %s", ca)
+			}
+			config.Net.TLS.Config.RootCAs = pool
+		}
+		if cert != "" {
+			pair, err := tls.LoadX509KeyPair(cert, key)
+			if err != nil {
+				return nil, err
+			}
+			config.Net.TLS.Config.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	// Responses are sent with a synchronous producer.
+	config.Producer.Return.Successes = true
+	return config, nil
+}
+
+func newClient(ctx context.Context) (cloudevents.Client, error) {
+	brokers, topics, group := env("CE_KAFKA_BROKERS"), env("CE_KAFKA_TOPICS"), os.Getenv("CE_KAFKA_GROUP")
+	if len(brokers) == 0 || len(topics) == 0 || group == "" {
+		return nil, errors.New("CE_KAFKA_BROKERS, CE_KAFKA_TOPICS and CE_KAFKA_GROUP must be set")
+	}
+	config, err := kafkaConfig()
+	if err != nil {
+		return nil, err
+	}
+	retries, err := maxRetries()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	cg, err := sarama.NewConsumerGroupFromClient(group, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	c := &consumer{
+		client:     client,
+		group:      cg,
+		topics:     topics,
+		maxRetries: retries,
+		incoming:   make(chan binding.Message),
+	}
+	if topic := os.Getenv("CE_KAFKA_REPLY_TOPIC"); topic != "" {
+		if c.sender, err = kafka.NewSenderFromClient(client, topic); err != nil {
+			cg.Close()
+			client.Close()
+			return nil, err
+		}
+	}
+
+	go serveAdmin(ctx)
+	return ceclient.NewObserved(c, ceclient.WithTimeNow(), ceclient.WithUUIDs())
+}
+
+// maxRetries returns the number of times that an event is redelivered after
+// the function fails to handle it, from CE_KAFKA_MAX_RETRIES, or -1 when it
+// is redelivered until the function succeeds.
+func maxRetries() (int, error) {
+	s := os.Getenv("CE_KAFKA_MAX_RETRIES")
+	if s == "" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("CE_KAFKA_MAX_RETRIES must be a non-negative integer, got %q", s)
+	}
+	return n, nil
+}
+
+// consumer passes the messages of the topics to the function, one partition
+// at a time and in order, and only marks the offset of a message to be
+// committed once the function has handled it.  Messages that the function
+// fails to handle are redelivered up to maxRetries times, unless the failure
+// is permanent.
+type consumer struct {
+	// client is shared by the consumer group and the sender, which don't
+	// close it.
+	client     sarama.Client
+	group      sarama.ConsumerGroup
+	topics     []string
+	maxRetries int
+	incoming   chan binding.Message
+
+	// sender sends the responses of the function, if set.
+	sender *kafka.Sender
+}
+
+var _ protocol.Responder = (*consumer)(nil)
+var _ protocol.Receiver = (*consumer)(nil)
+var _ protocol.Opener = (*consumer)(nil)
+var _ sarama.ConsumerGroupHandler = (*consumer)(nil)
+
+// OpenInbound implements protocol.Opener
+func (c *consumer) OpenInbound(ctx context.Context) error {
+	defer c.close()
+	for ctx.Err() == nil {
+		if err := c.group.Consume(ctx, c.topics, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close leaves the consumer group, and closes the sender and the client.
+func (c *consumer) close() {
+	if err := c.group.Close(); err != nil {
+		log.Printf("Failed to close the consumer group: %v", err)
+	}
+	if c.sender != nil {
+		if err := c.sender.Close(context.Background()); err != nil {
+			log.Printf("Failed to close the sender: %v", err)
+		}
+	}
+	if err := c.client.Close(); err != nil {
+		log.Printf("Failed to close the client: %v", err)
+	}
+}
+
+// Respond implements protocol.Responder
+func (c *consumer) Respond(ctx context.Context) (binding.Message, protocol.ResponseFn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil, io.EOF
+	case m := <-c.incoming:
+		return m, c.respond, nil
+	}
+}
+
+// Receive implements protocol.Receiver
+func (c *consumer) Receive(ctx context.Context) (binding.Message, error) {
+	m, _, err := c.Respond(ctx)
+	return m, err
+}
+
+// respond sends the response of the function to CE_KAFKA_REPLY_TOPIC, and
+// returns the result of the message.
+func (c *consumer) respond(ctx context.Context, m binding.Message, result protocol.Result, transformers ...binding.Transformer) error {
+	if m == nil || !protocol.IsACK(result) {
+		return result
+	}
+	if c.sender == nil {
+		log.Print("Dropping the response event, as CE_KAFKA_REPLY_TOPIC is not set")
+		return result
+	}
+	if err := c.sender.Send(ctx, m, transformers...); err != nil {
+		return fmt.Errorf("failed to send the response event: %w", err)
+	}
+	return result
+}
+
+// Setup implements sarama.ConsumerGroupHandler
+func (c *consumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler
+func (c *consumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler
+func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	for message := range claim.Messages() {
+		m := kafka.NewMessageFromConsumerMessage(message)
+		if event, err := binding.ToEvent(ctx, m); err != nil {
+			log.Printf("Skipping message %s/%d@%d, which is not a CloudEvent: %v", message.Topic, message.Partition, message.Offset, err)
+		} else if err := event.Validate(); err != nil {
+			log.Printf("Skipping message %s/%d@%d, which is not a valid CloudEvent: %v", message.Topic, message.Partition, message.Offset, err)
+		} else {
+			for attempt := 0; ; attempt++ {
+				result, ok := c.deliver(ctx, m)
+				if !ok {
+					// The session ended, so leave the message to be
+					// redelivered.
+					return nil
+				}
+				var perm permanentError
+				if errors.As(result, &perm) {
+					log.Printf("Skipping event %s: %v", event.ID(), result)
+					break
+				} else if protocol.IsACK(result) {
+					break
+				} else if c.maxRetries >= 0 && attempt >= c.maxRetries {
+					log.Printf("Skipping event %s after %d retries: %v", event.ID(), attempt, result)
+					break
+				}
+				delay := backoff(attempt)
+				log.Printf("Retrying event %s in %v: %v", event.ID(), delay, result)
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+		session.MarkMessage(message, "")
+	}
+	return nil
+}
+
+// deliver passes the message to the function, and returns its result, or
+// false if ctx is cancelled first.
+func (c *consumer) deliver(ctx context.Context, m binding.Message) (protocol.Result, bool) {
+	done := make(chan error, 1)
+	select {
+	case c.incoming <- binding.WithFinish(m, func(err error) { done <- err }):
+	case <-ctx.Done():
+		return nil, false
+	}
+	select {
+	case err := <-done:
+		return err, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// backoff returns the delay before the given attempt to redeliver an event.
+func backoff(attempt int) time.Duration {
+	if attempt > 8 {
+		attempt = 8
+	}
+	return 100 * time.Millisecond << attempt
+}
+`
+
+const protocolNATS = `
+// +build nats
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	cenats "github.com/cloudevents/sdk-go/protocol/nats/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	ceclient "github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	"github.com/nats-io/nats.go"
+)
+
+// permanentError is the result for an event that redelivering cannot help,
+// whose delivery is terminated rather than retried.
+type permanentError struct {
+	error
+}
+
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return permanentError{fmt.Errorf("failed to decode event data: %w", err)}
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return permanentError{fmt.Errorf("no handler for event type %q", event.Type())}
+}
+
+func newClient(ctx context.Context) (cloudevents.Client, error) {
+	subject := os.Getenv("CE_NATS_SUBJECT")
+	if subject == "" {
+		return nil, errors.New("CE_NATS_SUBJECT must be set")
+	}
+	url := os.Getenv("CE_NATS_URL")
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := cenats.NewConsumerFromConn(conn, subject)
+	if err != nil {
+		return nil, err
+	}
+	s := &subscriber{Consumer: consumer, conn: conn}
+
+	queue := os.Getenv("CE_NATS_QUEUE")
+	if durable := os.Getenv("CE_NATS_JETSTREAM_DURABLE"); durable != "" {
+		js, err := conn.JetStream()
+		if err != nil {
+			return nil, err
+		}
+		consumer.Subscriber = &jetStreamSubscriber{js: js, queue: queue, durable: durable}
+		s.jetStream = true
+	} else if queue != "" {
+		consumer.Subscriber = &cenats.QueueSubscriber{Queue: queue}
+	}
+
+	go serveAdmin(ctx)
+	return ceclient.NewObserved(s, ceclient.WithTimeNow(), ceclient.WithUUIDs())
+}
+
+// subscriber passes the messages of the subject to the function.  Responses
+// are sent to the reply subject of requests.  Messages from JetStream are
+// acknowledged once the function has handled them, and redelivered when it
+// fails, unless the failure is permanent.
+type subscriber struct {
+	*cenats.Consumer
+	conn      *nats.Conn
+	jetStream bool
+}
+
+var _ protocol.Responder = (*subscriber)(nil)
+var _ protocol.Receiver = (*subscriber)(nil)
+var _ protocol.Opener = (*subscriber)(nil)
+
+// Respond implements protocol.Responder
+func (s *subscriber) Respond(ctx context.Context) (binding.Message, protocol.ResponseFn, error) {
+	for {
+		m, err := s.Consumer.Receive(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg := m.(*cenats.Message).Msg
+		if !s.jetStream {
+			return m, s.reply(msg), nil
+		}
+
+		if event, err := binding.ToEvent(ctx, m); err != nil {
+			log.Printf("Terminating message %s, which is not a CloudEvent: %v", msg.Subject, err)
+		} else if err := event.Validate(); err != nil {
+			log.Printf("Terminating message %s, which is not a valid CloudEvent: %v", msg.Subject, err)
+		} else {
+			return binding.WithFinish(m, func(err error) { settle(msg, err) }), s.reply(msg), nil
+		}
+		if err := msg.Term(); err != nil {
+			log.Printf("Failed to terminate message %s: %v", msg.Subject, err)
+		}
+	}
+}
+
+// Receive implements protocol.Receiver
+func (s *subscriber) Receive(ctx context.Context) (binding.Message, error) {
+	m, _, err := s.Respond(ctx)
+	return m, err
+}
+
+// reply returns the function that sends the response of the function to the
+// reply subject of msg, and returns the result of the message.
+func (s *subscriber) reply(msg *nats.Msg) protocol.ResponseFn {
+	return func(ctx context.Context, m binding.Message, result protocol.Result, transformers ...binding.Transformer) error {
+		if m == nil || !protocol.IsACK(result) {
+			return result
+		}
+		if s.jetStream || msg.Reply == "" {
+			log.Print("Dropping the response event, as the message is not a request")
+			return result
+		}
+		var buf bytes.Buffer
+		if err := cenats.WriteMsg(ctx, m, &buf, transformers...); err != nil {
+			return fmt.Errorf("failed to encode the response event: %w", err)
+		}
+		if err := s.conn.Publish(msg.Reply, buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to send the response event: %w", err)
+		}
+		return result
+	}
+}
+
+// settle acknowledges the JetStream message once the function has handled it,
+// or asks for it to be redelivered, unless the failure is permanent.
+func settle(msg *nats.Msg, result error) {
+	var perm permanentError
+	var err error
+	switch {
+	case protocol.IsACK(result):
+		err = msg.Ack()
+	case errors.As(result, &perm):
+		log.Printf("Terminating message %s: %v", msg.Subject, result)
+		err = msg.Term()
+	default:
+		log.Printf("Redelivering message %s: %v", msg.Subject, result)
+		err = msg.Nak()
+	}
+	if err != nil {
+		log.Printf("Failed to settle message %s: %v", msg.Subject, err)
+	}
+}
+
+// jetStreamSubscriber subscribes to the subject through a JetStream durable
+// consumer, whose messages are acknowledged explicitly.
+type jetStreamSubscriber struct {
+	js      nats.JetStreamContext
+	queue   string
+	durable string
+}
+
+var _ cenats.Subscriber = (*jetStreamSubscriber)(nil)
+
+// Subscribe implements cenats.Subscriber
+func (s *jetStreamSubscriber) Subscribe(conn *nats.Conn, subject string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	opts := []nats.SubOpt{nats.Durable(s.durable), nats.ManualAck(), nats.AckExplicit()}
+	if s.queue != "" {
+		return s.js.QueueSubscribe(subject, s.queue, cb, opts...)
+	}
+	return s.js.Subscribe(subject, cb, opts...)
+}
+`
+
+const protocolAMQP = `
+// +build amqp
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Azure/go-amqp"
+	ceamqp "github.com/cloudevents/sdk-go/protocol/amqp/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	ceclient "github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+// permanentError is the result for an event that redelivering cannot help,
+// which is rejected rather than released.
+type permanentError struct {
+	error
+}
+
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return permanentError{fmt.Errorf("failed to decode event data: %w", err)}
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return permanentError{fmt.Errorf("no handler for event type %q", event.Type())}
+}
+
+// linkOptions returns the options of the link that receives from the node,
+// from the CE_AMQP_* environment variables.
+func linkOptions(node string) ([]amqp.LinkOption, error) {
+	opts := []amqp.LinkOption{amqp.LinkSourceAddress(node)}
+	if credit := os.Getenv("CE_AMQP_CREDIT"); credit != "" {
+		n, err := strconv.ParseUint(credit, 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("CE_AMQP_CREDIT must be a positive integer, got %q", credit)
+		}
+		opts = append(opts, amqp.LinkCredit(uint32(n)))
+	}
+	if name := os.Getenv("CE_AMQP_LINK_NAME"); name != "" {
+		opts = append(opts, amqp.LinkName(name))
+	}
+	if selector := os.Getenv("CE_AMQP_SELECTOR"); selector != "" {
+		opts = append(opts, amqp.LinkSelectorFilter(selector))
+	}
+	return opts, nil
+}
+
+func newClient(ctx context.Context) (cloudevents.Client, error) {
+	url, node := os.Getenv("CE_AMQP_URL"), os.Getenv("CE_AMQP_NODE")
+	if url == "" || node == "" {
+		return nil, errors.New("CE_AMQP_URL and CE_AMQP_NODE must be set")
+	}
+	opts, err := linkOptions(node)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.NewReceiver(opts...)
+	if err != nil {
+		return nil, err
+	}
+	rcv := &receiver{receiver: ceamqp.NewReceiver(r)}
+	if reply := os.Getenv("CE_AMQP_REPLY_NODE"); reply != "" {
+		s, err := session.NewSender(amqp.LinkTargetAddress(reply))
+		if err != nil {
+			return nil, err
+		}
+		rcv.sender = ceamqp.NewSender(s)
+	}
+
+	go serveAdmin(ctx)
+	return ceclient.NewObserved(rcv, ceclient.WithTimeNow(), ceclient.WithUUIDs())
+}
+
+// receiver passes the messages of the node to the function, and settles them
+// once it has handled them.
+type receiver struct {
+	receiver protocol.Receiver
+
+	// sender sends the responses of the function, if set.
+	sender protocol.Sender
+}
+
+var _ protocol.Responder = (*receiver)(nil)
+var _ protocol.Receiver = (*receiver)(nil)
+
+// Respond implements protocol.Responder
+func (r *receiver) Respond(ctx context.Context) (binding.Message, protocol.ResponseFn, error) {
+	for {
+		m, err := r.receiver.Receive(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg := m.(*ceamqp.Message)
+		if event, err := binding.ToEvent(ctx, msg); err != nil {
+			err = fmt.Errorf("not a CloudEvent: %w", err)
+			log.Printf("Rejecting message: %v", err)
+			err = msg.AMQP.Reject(&amqp.Error{Condition: amqp.ErrorDecodeError, Description: err.Error()})
+		} else if err := event.Validate(); err != nil {
+			err = fmt.Errorf("not a valid CloudEvent: %w", err)
+			log.Printf("Rejecting message: %v", err)
+			err = msg.AMQP.Reject(&amqp.Error{Condition: amqp.ErrorDecodeError, Description: err.Error()})
+		} else {
+			return message{msg}, r.respond, nil
+		}
+		if err != nil {
+			log.Printf("Failed to reject message: %v", err)
+		}
+	}
+}
+
+// Receive implements protocol.Receiver
+func (r *receiver) Receive(ctx context.Context) (binding.Message, error) {
+	m, _, err := r.Respond(ctx)
+	return m, err
+}
+
+// respond sends the response of the function to CE_AMQP_REPLY_NODE, and
+// returns the result of the message.
+func (r *receiver) respond(ctx context.Context, m binding.Message, result protocol.Result, transformers ...binding.Transformer) error {
+	if m == nil || !protocol.IsACK(result) {
+		return result
+	}
+	if r.sender == nil {
+		log.Print("Dropping the response event, as CE_AMQP_REPLY_NODE is not set")
+		return result
+	}
+	if err := r.sender.Send(ctx, m, transformers...); err != nil {
+		return fmt.Errorf("failed to send the response event: %w", err)
+	}
+	return result
+}
+
+// message settles the AMQP message according to the result of the function,
+// rather than accepting or rejecting it as the binding does.
+type message struct {
+	*ceamqp.Message
+}
+
+// Finish implements binding.Message
+func (m message) Finish(result error) error {
+	switch disposition(result) {
+	case "accepted":
+		return m.AMQP.Accept()
+	case "rejected":
+		log.Printf("Rejecting message: %v", result)
+		return m.AMQP.Reject(&amqp.Error{Condition: amqp.ErrorInternalError, Description: result.Error()})
+	default:
+		log.Printf("Releasing message: %v", result)
+		return m.AMQP.Release()
+	}
+}
+
+// disposition returns the outcome of a message with the result: accepted when
+// the function succeeds, rejected when redelivering the message cannot help,
+// and released, for it to be redelivered, otherwise, including when the
+// function returns a NACK.
+func disposition(result error) string {
+	var perm permanentError
+	switch {
+	case protocol.IsACK(result):
+		return "accepted"
+	case errors.As(result, &perm):
+		return "rejected"
+	default:
+		return "released"
+	}
+}
+`
+
+const protocolMQTT = `
+// +build mqtt
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/cloudevents/sdk-go/v2/binding/spec"
+	ceclient "github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// specs holds the CloudEvents attributes, which MQTT 5 user properties name
+// without a prefix.
+var specs = spec.New()
+
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return fmt.Errorf("failed to decode event data: %w", err)
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return fmt.Errorf("no handler for event type %q", event.Type())
+}
+
+// env returns the comma-separated list in the environment variable.
+func env(name string) []string {
+	var list []string
+	for _, s := range strings.Split(os.Getenv(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// secure returns whether the mqtt:// or mqtts:// URL of the broker asks for
+// TLS.
+func secure(broker *url.URL) (bool, error) {
+	switch broker.Scheme {
+	case "mqtt", "tcp":
+		return false, nil
+	case "mqtts", "ssl", "tls":
+		return true, nil
+	default:
+		return false, fmt.Errorf("CE_MQTT_BROKER must be an mqtt:// or mqtts:// URL, got %q", broker)
+	}
+}
+
+// address returns the address of the broker, with the default port of MQTT,
+// or of MQTT over TLS when useTLS is set, unless the URL has one.
+func address(broker *url.URL, useTLS bool) string {
+	if broker.Port() != "" {
+		return broker.Host
+	}
+	if useTLS {
+		return net.JoinHostPort(broker.Hostname(), "8883")
+	}
+	return net.JoinHostPort(broker.Hostname(), "1883")
+}
+
+// dial connects to the broker, over TLS when useTLS is set.
+func dial(ctx context.Context, broker *url.URL, useTLS bool) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if useTLS {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: broker.Hostname()}}
+		conn, err = d.DialContext(ctx, "tcp", address(broker, useTLS))
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address(broker, useTLS))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return packets.NewThreadSafeConn(conn), nil
+}
+
+// clientConfig returns the configuration of the connection to the broker,
+// with the credentials of the broker URL and the CE_MQTT_* environment
+// variables.
+func clientConfig(broker *url.URL) (autopaho.ClientConfig, error) {
+	useTLS, err := secure(broker)
+	if err != nil {
+		return autopaho.ClientConfig{}, err
+	}
+	clean := true
+	if s := os.Getenv("CE_MQTT_CLEAN_SESSION"); s != "" {
+		if clean, err = strconv.ParseBool(s); err != nil {
+			return autopaho.ClientConfig{}, fmt.Errorf("CE_MQTT_CLEAN_SESSION must be true or false, got %q", s)
+		}
+	}
+	id := os.Getenv("CE_MQTT_CLIENT_ID")
+	if id == "" && !clean {
+		return autopaho.ClientConfig{}, errors.New("CE_MQTT_CLIENT_ID must be set when CE_MQTT_CLEAN_SESSION is false")
+	}
+
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{broker},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: clean,
+		ConnectRetryDelay:             5 * time.Second,
+		AttemptConnection: func(ctx context.Context, cfg autopaho.ClientConfig, broker *url.URL) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+			defer cancel()
+			return dial(ctx, broker, useTLS)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:                   id,
+			EnableManualAcknowledgment: true,
+		},
+	}
+	if !clean {
+		// The session outlives the connection, so that messages published
+		// while the function is down are delivered when it reconnects.
+		cfg.SessionExpiryInterval = math.MaxUint32
+	}
+	if broker.User != nil {
+		cfg.ConnectUsername = broker.User.Username()
+		if password, ok := broker.User.Password(); ok {
+			cfg.ConnectPassword = []byte(password)
+		}
+	}
+	return cfg, nil
+}
+
+// qos returns the QoS of the subscriptions and responses, from CE_MQTT_QOS.
+func qos() (byte, error) {
+	switch s := os.Getenv("CE_MQTT_QOS"); s {
+	case "", "1":
+		return 1, nil
+	case "0":
+		return 0, nil
+	case "2":
+		return 2, nil
+	default:
+		return 0, fmt.Errorf("CE_MQTT_QOS must be 0, 1 or 2, got %q", s)
+	}
+}
+
+func newClient(ctx context.Context) (cloudevents.Client, error) {
+	topics := env("CE_MQTT_TOPICS")
+	if os.Getenv("CE_MQTT_BROKER") == "" || len(topics) == 0 {
+		return nil, errors.New("CE_MQTT_BROKER and CE_MQTT_TOPICS must be set")
+	}
+	broker, err := url.Parse(os.Getenv("CE_MQTT_BROKER"))
+	if err != nil {
+		return nil, fmt.Errorf("malformed CE_MQTT_BROKER: %w", err)
+	}
+	cfg, err := clientConfig(broker)
+	if err != nil {
+		return nil, err
+	}
+	s := &subscriber{
+		incoming:      make(chan message),
+		done:          make(chan struct{}),
+		responseTopic: os.Getenv("CE_MQTT_RESPONSE_TOPIC"),
+	}
+	if s.qos, err = qos(); err != nil {
+		return nil, err
+	}
+	sub := &paho.Subscribe{}
+	for _, topic := range topics {
+		sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: s.qos})
+	}
+
+	// The connection is re-established whenever it is lost, and the topic
+	// filters subscribed to again, so that the function rides out broker
+	// restarts.  The first subscription is awaited before serving.
+	subscribed := make(chan error, 1)
+	cfg.OnConnectionUp = func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+		_, err := cm.Subscribe(ctx, sub)
+		select {
+		case subscribed <- err:
+		default:
+			if err != nil {
+				log.Printf("Failed to subscribe to %s again: %v", strings.Join(topics, ","), err)
+			}
+		}
+	}
+	cfg.OnConnectError = func(err error) {
+		log.Printf("Failed to connect to the MQTT broker, retrying: %v", err)
+	}
+	cfg.OnClientError = func(err error) {
+		log.Printf("Lost the connection to the MQTT broker, reconnecting: %v", err)
+	}
+	cfg.OnServerDisconnect = func(d *paho.Disconnect) {
+		log.Printf("The MQTT broker disconnected with reason code %d, reconnecting", d.ReasonCode)
+	}
+	cfg.OnPublishReceived = []func(paho.PublishReceived) (bool, error){
+		func(pr paho.PublishReceived) (bool, error) {
+			select {
+			case s.incoming <- message{Publish: pr.Packet, client: pr.Client}:
+				return true, nil
+			case <-s.done:
+				// The message is left unacknowledged, for the broker to
+				// redeliver it, unless the session is clean.
+				return false, nil
+			}
+		},
+	}
+	// The connection outlives ctx, so that the responses to the messages
+	// that are handled while the function drains are published.
+	// OpenInbound closes it.
+	if s.conn, err = autopaho.NewConnection(context.Background(), cfg); err != nil {
+		return nil, err
+	}
+	select {
+	case err = <-subscribed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		s.conn.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", strings.Join(topics, ","), err)
+	}
+
+	go serveAdmin(ctx)
+	return ceclient.NewObserved(s, ceclient.WithTimeNow(), ceclient.WithUUIDs())
+}
+
+// subscriber passes the messages of the topic filters to the function, and
+// acknowledges them once it has handled them.  MQTT can't ask for a message
+// to be redelivered, so messages are acknowledged whatever the result.
+type subscriber struct {
+	conn     *autopaho.ConnectionManager
+	incoming chan message
+	qos      byte
+
+	// done is closed once the function stops receiving messages.
+	done chan struct{}
+
+	// responseTopic is the topic of the responses to messages that don't
+	// set their own.
+	responseTopic string
+}
+
+// message is a message of the topic filters, along with the client of the
+// connection that it was received on, which acknowledges it.
+type message struct {
+	*paho.Publish
+	client *paho.Client
+}
+
+var _ protocol.Responder = (*subscriber)(nil)
+var _ protocol.Receiver = (*subscriber)(nil)
+var _ protocol.Opener = (*subscriber)(nil)
+
+// OpenInbound implements protocol.Opener
+func (s *subscriber) OpenInbound(ctx context.Context) error {
+	<-ctx.Done()
+	close(s.done)
+	return s.conn.Disconnect(context.Background())
+}
+
+// Respond implements protocol.Responder
+func (s *subscriber) Respond(ctx context.Context) (binding.Message, protocol.ResponseFn, error) {
+	for {
+		var p message
+		select {
+		case <-ctx.Done():
+			return nil, nil, io.EOF
+		case p = <-s.incoming:
+		}
+		event, err := toEvent(p.Publish)
+		if err == nil {
+			err = event.Validate()
+		}
+		if err != nil {
+			log.Printf("Skipping message on %s, which is not a valid CloudEvent: %v", p.Topic, err)
+			s.ack(p)
+			continue
+		}
+		m := binding.WithFinish(binding.ToMessage(event), func(error) { s.ack(p) })
+		return m, s.reply(p.Publish), nil
+	}
+}
+
+// Receive implements protocol.Receiver
+func (s *subscriber) Receive(ctx context.Context) (binding.Message, error) {
+	m, _, err := s.Respond(ctx)
+	return m, err
+}
+
+// ack acknowledges the message on the connection that it was received on.
+// The messages of a lost connection are redelivered on the next one, unless
+// the session is clean.
+func (s *subscriber) ack(p message) {
+	if err := p.client.Ack(p.Publish); err != nil {
+		log.Printf("Failed to acknowledge message on %s: %v", p.Topic, err)
+	}
+}
+
+// reply returns the function that publishes the response of the function to
+// the response topic of the request, or CE_MQTT_RESPONSE_TOPIC, and returns
+// the result of the message.
+func (s *subscriber) reply(req *paho.Publish) protocol.ResponseFn {
+	return func(ctx context.Context, m binding.Message, result protocol.Result, transformers ...binding.Transformer) error {
+		if m == nil || !protocol.IsACK(result) {
+			return result
+		}
+		topic := s.responseTopic
+		var correlation []byte
+		if req.Properties != nil && req.Properties.ResponseTopic != "" {
+			topic, correlation = req.Properties.ResponseTopic, req.Properties.CorrelationData
+		}
+		if topic == "" {
+			log.Print("Dropping the response event, as neither the message nor CE_MQTT_RESPONSE_TOPIC set a response topic")
+			return result
+		}
+
+		event, err := binding.ToEvent(ctx, m, transformers...)
+		if err != nil {
+			return fmt.Errorf("failed to encode the response event: %w", err)
+		}
+		p, err := toPublish(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode the response event: %w", err)
+		}
+		p.Topic, p.QoS = topic, s.qos
+		p.Properties.CorrelationData = correlation
+		if _, err := s.conn.Publish(ctx, p); err != nil {
+			return fmt.Errorf("failed to send the response event: %w", err)
+		}
+		return result
+	}
+}
+
+// toEvent decodes the event in the message: in binary mode when its MQTT 5
+// user properties hold the specversion, as the CloudEvents MQTT binding
+// specifies, and in structured mode otherwise, as with MQTT 3.1.1.  User
+// properties that can't name a CloudEvents attribute or extension are
+// ignored, as other applications set them too.
+func toEvent(p *paho.Publish) (*cloudevents.Event, error) {
+	var contentType string
+	var user paho.UserProperties
+	if p.Properties != nil {
+		contentType, user = p.Properties.ContentType, p.Properties.User
+	}
+
+	if v := specs.Version(user.Get("specversion")); v != nil {
+		event := cloudevents.Event{Context: v.NewContext()}
+		for _, u := range user {
+			if v.Attribute(u.Key) == nil && !extensionName(u.Key) {
+				continue
+			}
+			if err := v.SetAttribute(event.Context, u.Key, u.Value); err != nil {
+				return nil, err
+			}
+		}
+		if contentType != "" {
+			event.SetDataContentType(contentType)
+		}
+		if len(p.Payload) > 0 {
+			event.DataEncoded = p.Payload
+		}
+		return &event, nil
+	}
+
+	if contentType != "" && format.Lookup(contentType) == nil {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	event := cloudevents.NewEvent()
+	if err := json.Unmarshal(p.Payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// extensionName returns whether name can name a CloudEvents extension, whose
+// names consist of ASCII letters and digits.
+func extensionName(name string) bool {
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// toPublish encodes the event in binary mode, with its attributes in MQTT 5
+// user properties.
+func toPublish(event *cloudevents.Event) (*paho.Publish, error) {
+	v := specs.Version(event.SpecVersion())
+	if v == nil {
+		return nil, fmt.Errorf("unsupported specversion %q", event.SpecVersion())
+	}
+	props := &paho.PublishProperties{ContentType: event.DataContentType()}
+	for _, attr := range v.Attributes() {
+		value := attr.Get(event.Context)
+		if attr.Kind() == spec.DataContentType || types.IsZero(value) {
+			continue
+		}
+		s, err := types.Format(value)
+		if err != nil {
+			return nil, err
+		}
+		props.User.Add(attr.Name(), s)
+	}
+	for name, value := range event.Extensions() {
+		s, err := types.Format(value)
+		if err != nil {
+			return nil, err
+		}
+		props.User.Add(name, s)
+	}
+	return &paho.Publish{Properties: props, Payload: event.Data()}, nil
+}
+`
+
+const protocolPubSub = `
+// +build pubsub
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	cepubsub "github.com/cloudevents/sdk-go/protocol/pubsub/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	ceclient "github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// permanentError is the result for an event that redelivering cannot help,
+// which is acked rather than nacked.
+type permanentError struct {
+	error
+}
+
+// badRequest returns the result for an event whose data cannot be decoded.
+func badRequest(err error) error {
+	return permanentError{fmt.Errorf("failed to decode event data: %w", err)}
+}
+
+// noHandler returns the result for an event that the function doesn't handle.
+func noHandler(event cloudevents.Event) error {
+	return permanentError{fmt.Errorf("no handler for event type %q", event.Type())}
+}
+
+// autoCreate returns whether the topics and the subscription are created when
+// they don't exist, from CE_PUBSUB_AUTO_CREATE.
+func autoCreate() (bool, error) {
+	s := os.Getenv("CE_PUBSUB_AUTO_CREATE")
+	if s == "" {
+		return false, nil
+	}
+	create, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("CE_PUBSUB_AUTO_CREATE must be true or false, got %q", s)
+	}
+	return create, nil
+}
+
+// ackDeadline returns the ack deadline of the subscription that is created,
+// from CE_PUBSUB_ACK_DEADLINE.
+func ackDeadline() (time.Duration, error) {
+	s := os.Getenv("CE_PUBSUB_ACK_DEADLINE")
+	if s == "" {
+		return 30 * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 10*time.Second || d > 10*time.Minute {
+		return 0, fmt.Errorf("CE_PUBSUB_ACK_DEADLINE must be a duration between 10s and 10m, got %q", s)
+	}
+	return d, nil
+}
+
+// receiveSettings returns the flow control of the subscription, from
+// CE_PUBSUB_MAX_OUTSTANDING.  The settings left zero take the defaults of the
+// Pub/Sub client.
+func receiveSettings() (*pubsub.ReceiveSettings, error) {
+	rs := &pubsub.ReceiveSettings{}
+	if s := os.Getenv("CE_PUBSUB_MAX_OUTSTANDING"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("CE_PUBSUB_MAX_OUTSTANDING must be a positive integer, got %q", s)
+		}
+		rs.MaxOutstandingMessages = n
+	}
+	return rs, nil
+}
+
+// ensureSubscription creates the subscription to the topic, and the topic,
+// unless they exist.  Another replica of the function may create them first.
+func ensureSubscription(ctx context.Context, client *pubsub.Client, id, topicID string, deadline time.Duration) error {
+	if ok, err := client.Subscription(id).Exists(ctx); err != nil || ok {
+		return err
+	}
+	if topicID == "" {
+		return fmt.Errorf("CE_PUBSUB_TOPIC must be set to create subscription %q", id)
+	}
+	topic := client.Topic(topicID)
+	if ok, err := topic.Exists(ctx); err != nil {
+		return err
+	} else if !ok {
+		if _, err := client.CreateTopic(ctx, topicID); err != nil && status.Code(err) != codes.AlreadyExists {
+			return err
+		}
+	}
+	_, err := client.CreateSubscription(ctx, id, pubsub.SubscriptionConfig{Topic: topic, AckDeadline: deadline})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func newClient(ctx context.Context) (cloudevents.Client, error) {
+	project, subscription, topic := os.Getenv("CE_PUBSUB_PROJECT"), os.Getenv("CE_PUBSUB_SUBSCRIPTION"), os.Getenv("CE_PUBSUB_TOPIC")
+	if project == "" || subscription == "" {
+		return nil, errors.New("CE_PUBSUB_PROJECT and CE_PUBSUB_SUBSCRIPTION must be set")
+	}
+	create, err := autoCreate()
+	if err != nil {
+		return nil, err
+	}
+	deadline, err := ackDeadline()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := receiveSettings()
+	if err != nil {
+		return nil, err
+	}
+	// The client connects to PUBSUB_EMULATOR_HOST rather than Pub/Sub, if set.
+	client, err := pubsub.NewClient(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		if err := ensureSubscription(ctx, client, subscription, topic, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := []cepubsub.Option{
+		cepubsub.WithClient(client),
+		cepubsub.WithProjectID(project),
+		cepubsub.WithSubscriptionAndTopicID(subscription, topic),
+		cepubsub.WithReceiveSettings(rs),
+		cepubsub.AllowCreateTopic(create),
+	}
+	reply := os.Getenv("CE_PUBSUB_REPLY_TOPIC")
+	if reply != "" {
+		opts = append(opts, cepubsub.WithTopicID(reply))
+	}
+	p, err := cepubsub.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	go serveAdmin(ctx)
+	return ceclient.NewObserved(&subscriber{protocol: p, reply: reply != ""}, ceclient.WithTimeNow(), ceclient.WithUUIDs())
+}
+
+// subscriber passes the messages of the subscription to the function, and acks
+// or nacks them once it has handled them.
+type subscriber struct {
+	protocol *cepubsub.Protocol
+
+	// reply is whether the responses of the function are sent to
+	// CE_PUBSUB_REPLY_TOPIC.
+	reply bool
+}
+
+var _ protocol.Responder = (*subscriber)(nil)
+var _ protocol.Receiver = (*subscriber)(nil)
+var _ protocol.Opener = (*subscriber)(nil)
+
+// OpenInbound implements protocol.Opener
+func (s *subscriber) OpenInbound(ctx context.Context) error {
+	return s.protocol.OpenInbound(ctx)
+}
+
+// Respond implements protocol.Responder
+func (s *subscriber) Respond(ctx context.Context) (binding.Message, protocol.ResponseFn, error) {
+	for {
+		m, err := s.protocol.Receive(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg := m.(*cepubsub.Message)
+		if event, err := binding.ToEvent(ctx, msg); err != nil {
+			log.Printf("Dropping message, which is not a CloudEvent: %v", err)
+		} else if err := event.Validate(); err != nil {
+			log.Printf("Dropping message, which is not a valid CloudEvent: %v", err)
+		} else {
+			return message{msg}, s.respond, nil
+		}
+		// Redelivering the message cannot help, so it is acked.
+		msg.Finish(nil)
+	}
+}
+
+// Receive implements protocol.Receiver
+func (s *subscriber) Receive(ctx context.Context) (binding.Message, error) {
+	m, _, err := s.Respond(ctx)
+	return m, err
+}
+
+// respond sends the response of the function to CE_PUBSUB_REPLY_TOPIC, and
+// returns the result of the message.
+func (s *subscriber) respond(ctx context.Context, m binding.Message, result protocol.Result, transformers ...binding.Transformer) error {
+	if m == nil || !protocol.IsACK(result) {
+		return result
+	}
+	if !s.reply {
+		log.Print("Dropping the response event, as CE_PUBSUB_REPLY_TOPIC is not set")
+		return result
+	}
+	if err := s.protocol.Send(ctx, m, transformers...); err != nil {
+		return fmt.Errorf("failed to send the response event: %w", err)
+	}
+	return result
+}
+
+// message acks the Pub/Sub message when the function succeeds or when
+// redelivering it cannot help, and nacks it for it to be redelivered
+// otherwise, including when the function returns a NACK.
+type message struct {
+	*cepubsub.Message
+}
+
+// Finish implements binding.Message
+func (m message) Finish(result error) error {
+	var perm permanentError
+	switch {
+	case protocol.IsACK(result):
+		return m.Message.Finish(nil)
+	case errors.As(result, &perm):
+		log.Printf("Dropping event: %v", result)
+		return m.Message.Finish(nil)
+	default:
+		log.Printf("Nacking event: %v", result)
+		return m.Message.Finish(result)
+	}
+}
+`
+
+// templateSources holds the source of each built-in template, keyed by the
+// name of the file that it renders, without its extension.
+var templateSources = map[string]string{
+	"main":   packageMain,
+	"http":   protocolHTTP,
+	"kafka":  protocolKafka,
+	"nats":   protocolNATS,
+	"amqp":   protocolAMQP,
+	"mqtt":   protocolMQTT,
+	"pubsub": protocolPubSub,
+}
+
+// parseTemplate parses the template with the given name and text, along with
+// the helpers.
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New("ce-go-function-" + name).Parse(templateHelpers)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(text)
+}
+
+// templateExt is the extension of the template files in CE_TEMPLATE_DIR.
+const templateExt = ".go.tmpl"
+
+// loadTemplates returns the templates that render the scaffolding for the
+// protocol, keyed by the name of the file that each renders without its
+// extension.  The built-in templates are overridden by the files in dir
+// (relative to workingDir), if set, which may also add files to the command
+// package.  Templates for other protocols are left out.
+func loadTemplates(workingDir, dir, protocol string) (map[string]source, error) {
+	templates := map[string]source{
+		"main": {Name: `template "main"`, Text: templateSources["main"]},
+	}
+	if text, ok := templateSources[protocol]; ok {
+		templates[protocol] = source{Name: fmt.Sprintf("template %q", protocol), Text: text}
+	}
+	if dir == "" {
+		return templates, nil
+	}
+
+	p := dir
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(workingDir, p)
+	}
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		name := strings.TrimSuffix(fi.Name(), templateExt)
+		if fi.IsDir() || name == fi.Name() {
+			continue
+		}
+		if _, builtin := templateSources[name]; builtin && name != "main" && name != protocol {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(p, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = source{Name: filepath.Join(dir, fi.Name()), Text: string(data)}
+	}
+	return templates, nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+func TestDisposition(t *testing.T) {
+	tests := []struct {
+		name   string
+		result error
+		want   string
+	}{{
+		name: "success",
+		want: "accepted",
+	}, {
+		name:   "ack",
+		result: protocol.ResultACK,
+		want:   "accepted",
+	}, {
+		name:   "nack",
+		result: protocol.NewReceipt(false, "order service unavailable"),
+		want:   "released",
+	}, {
+		name:   "permanent",
+		result: permanentError{errors.New("unsupported order")},
+		want:   "rejected",
+	}, {
+		name:   "wrapped permanent",
+		result: fmt.Errorf("failed: %w", permanentError{errors.New("unsupported order")}),
+		want:   "rejected",
+	}, {
+		name:   "bad request",
+		result: badRequest(errors.New("malformed")),
+		want:   "rejected",
+	}, {
+		name:   "no handler",
+		result: noHandler(cloudevents.NewEvent()),
+		want:   "rejected",
+	}, {
+		name:   "error",
+		result: errors.New("database unavailable"),
+		want:   "released",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := disposition(test.result); got != test.want {
+				t.Errorf("disposition() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{{
+		name: "default",
+		want: 1,
+	}, {
+		name: "all",
+		env: map[string]string{
+			"CE_AMQP_CREDIT":    "10",
+			"CE_AMQP_LINK_NAME": "fn",
+			"CE_AMQP_SELECTOR":  "priority > 3",
+		},
+		want: 4,
+	}, {
+		name:    "zero credit",
+		env:     map[string]string{"CE_AMQP_CREDIT": "0"},
+		wantErr: true,
+	}, {
+		name:    "malformed credit",
+		env:     map[string]string{"CE_AMQP_CREDIT": "many"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, k := range []string{"CE_AMQP_CREDIT", "CE_AMQP_LINK_NAME", "CE_AMQP_SELECTOR"} {
+				os.Setenv(k, test.env[k])
+			}
+			opts, err := linkOptions("orders")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("linkOptions() = %v, wanted error %v", err, test.wantErr)
+			}
+			if len(opts) != test.want {
+				t.Errorf("len(linkOptions()) = %d, wanted %d", len(opts), test.want)
+			}
+		})
+	}
+}
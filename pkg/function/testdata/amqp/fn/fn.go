@@ -0,0 +1,11 @@
+package fn
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receive(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
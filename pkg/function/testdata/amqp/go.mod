@@ -0,0 +1,9 @@
+module example.com/amqp
+
+go 1.14
+
+require (
+	github.com/Azure/go-amqp v0.12.7
+	github.com/cloudevents/sdk-go/protocol/amqp/v2 v2.3.1
+	github.com/cloudevents/sdk-go/v2 v2.3.1
+)
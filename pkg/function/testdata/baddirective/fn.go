@@ -0,0 +1,9 @@
+package foo
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+//cloudevents:function color=blue
+func Receiver(event cloudevents.Event) {
+}
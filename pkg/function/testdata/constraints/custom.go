@@ -0,0 +1,11 @@
+//go:build custom
+// +build custom
+
+package foo
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Custom(event cloudevents.Event) {
+}
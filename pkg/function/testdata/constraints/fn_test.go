@@ -0,0 +1,9 @@
+package foo
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Tests are not compiled into the function, so this is not a candidate.
+func Receiver(event cloudevents.Event) {
+}
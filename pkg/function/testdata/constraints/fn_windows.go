@@ -0,0 +1,8 @@
+package foo
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Windows(event cloudevents.Event) {
+}
@@ -0,0 +1,11 @@
+//go:build ignore
+// +build ignore
+
+package main
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Ignored(event cloudevents.Event) {
+}
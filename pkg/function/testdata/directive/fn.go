@@ -0,0 +1,17 @@
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Handle handles orders.
+//
+//cloudevents:function path=/orders types=com.example.order.*,com.example.refund
+func Handle(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+func Other(event cloudevents.Event) {
+}
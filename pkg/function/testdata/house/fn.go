@@ -0,0 +1,11 @@
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receiver(ctx context.Context, event *cloudevents.Event) error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/kafka/fn"
+	"github.com/Shopify/sarama"
+)
+
+const (
+	topic = "events"
+	group = "fn"
+)
+
+// TestMockBroker runs the scaffolding of the kafka protocol against a mock
+// broker.
+func TestMockBroker(t *testing.T) {
+	broker := mockBroker(t)
+	defer broker.Close()
+
+	os.Setenv("CE_KAFKA_BROKERS", broker.Addr())
+	os.Setenv("CE_KAFKA_TOPICS", topic)
+	os.Setenv("CE_KAFKA_GROUP", group)
+	os.Setenv("CE_KAFKA_INITIAL_OFFSET", "oldest")
+	go main()
+
+	// The flaky event is redelivered until the function succeeds, before the
+	// next event is delivered, and the offset after the last message is
+	// committed.
+	waitForEvents(t, broker, []string{"1", "1", "1", "2"})
+}
+
+// TestMaxRetries runs the scaffolding of the kafka protocol against a mock
+// broker, with fewer retries than the flaky event needs.
+func TestMaxRetries(t *testing.T) {
+	broker := mockBroker(t)
+	defer broker.Close()
+
+	os.Setenv("CE_KAFKA_BROKERS", broker.Addr())
+	os.Setenv("CE_KAFKA_TOPICS", topic)
+	os.Setenv("CE_KAFKA_GROUP", group)
+	os.Setenv("CE_KAFKA_INITIAL_OFFSET", "oldest")
+	os.Setenv("CE_KAFKA_MAX_RETRIES", "1")
+	go main()
+
+	// The flaky event is skipped after its retry fails, and its offset is
+	// committed along with the others.
+	waitForEvents(t, broker, []string{"1", "1", "2"})
+}
+
+// mockBroker returns a mock broker that serves three messages: a binary
+// event that the function fails twice, a structured event, and a message
+// that isn't an event.
+func mockBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+
+	// The function is assigned the only partition of the topic, by another
+	// member that leads the group.
+	var sync sarama.SyncGroupRequest
+	if err := sync.AddGroupAssignmentMember("member", &sarama.ConsumerGroupMemberAssignment{
+		Topics: map[string][]int32{topic: {0}},
+	}); err != nil {
+		t.Fatal("AddGroupAssignmentMember() =", err)
+	}
+
+	fetch := &sarama.FetchResponse{Version: 4}
+	fetch.AddRecord(topic, 0, nil, sarama.StringEncoder(`data`), 0)
+	fetch.AddRecord(topic, 0, nil, sarama.StringEncoder(`{"specversion":"1.0","id":"2","source":"test","type":"test"}`), 1)
+	fetch.AddRecord(topic, 0, nil, sarama.StringEncoder(`not an event`), 2)
+	fetch.SetLastStableOffset(topic, 0, 3)
+	records := fetch.GetBlock(topic, 0).RecordsSet[0].RecordBatch.Records
+	records[0].Headers = headers(map[string]string{
+		"ce_specversion": "1.0",
+		"ce_id":          "1",
+		"ce_source":      "test",
+		"ce_type":        "test",
+		"ce_subject":     "flaky",
+	})
+	records[1].Headers = headers(map[string]string{
+		"content-type": "application/cloudevents+json",
+	})
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, group, broker),
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			Version:      1,
+			GenerationId: 1,
+			LeaderId:     "leader",
+			MemberId:     "member",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: sync.GroupAssignments["member"],
+		}),
+		"HeartbeatRequest":  sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest": sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(group, topic, 0, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetVersion(1).
+			SetOffset(topic, 0, sarama.OffsetOldest, 0).
+			SetOffset(topic, 0, sarama.OffsetNewest, 3),
+		"FetchRequest":        sarama.NewMockWrapper(fetch),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+	return broker
+}
+
+// waitForEvents waits for the function to receive the events with the IDs
+// in want, and for the offset after the last message to be committed.
+func waitForEvents(t *testing.T, broker *sarama.MockBroker, want []string) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := fn.Received(); reflect.DeepEqual(got, want) && committed(broker) == 3 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("Received() = %v, wanted %v", fn.Received(), want)
+	t.Errorf("committed offset = %d, wanted 3", committed(broker))
+}
+
+// headers returns the record headers with the keys and values.
+func headers(kv map[string]string) []*sarama.RecordHeader {
+	var hs []*sarama.RecordHeader
+	for k, v := range kv {
+		hs = append(hs, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return hs
+}
+
+// committed returns the last offset that the broker was asked to commit, or
+// -1 if none.
+func committed(broker *sarama.MockBroker) int64 {
+	offset := int64(-1)
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			if o, _, err := req.Offset(topic, 0); err == nil {
+				offset = o
+			}
+		}
+	}
+	return offset
+}
@@ -0,0 +1,35 @@
+package fn
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+var (
+	mu       sync.Mutex
+	received []string
+	failures int
+)
+
+// Receive records the events that it receives, and fails the first two
+// deliveries of events with the subject "flaky".
+func Receive(ctx context.Context, event cloudevents.Event) error {
+	mu.Lock()
+	defer mu.Unlock()
+	received = append(received, event.ID())
+	if event.Subject() == "flaky" && failures < 2 {
+		failures++
+		return errors.New("flaky")
+	}
+	return nil
+}
+
+// Received returns the IDs of the events received so far.
+func Received() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), received...)
+}
@@ -0,0 +1,9 @@
+module example.com/kafka
+
+go 1.14
+
+require (
+	github.com/Shopify/sarama v1.25.0
+	github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2 v2.3.1
+	github.com/cloudevents/sdk-go/v2 v2.3.1
+)
@@ -0,0 +1,35 @@
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type Handler struct {
+	greeting string
+}
+
+func NewHandler(ctx context.Context) (*Handler, error) {
+	return &Handler{greeting: "hello"}, nil
+}
+
+func (h *Handler) Receive(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+// Orphan has no constructor, so its method cannot be used.
+type Orphan struct{}
+
+func (o Orphan) Receive(event cloudevents.Event) {
+}
+
+// Value's constructor returns a value, on which Receive cannot be called.
+type Value struct{}
+
+func NewValue(ctx context.Context) (Value, error) {
+	return Value{}, nil
+}
+
+func (v *Value) Receive(event cloudevents.Event) {
+}
@@ -0,0 +1,5 @@
+module (
+	example.com/block
+)
+
+go 1.14
@@ -0,0 +1,8 @@
+package fn
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receiver(event cloudevents.Event) {
+}
@@ -0,0 +1,6 @@
+// This exercises syntax that splitting lines on spaces doesn't understand.
+module	"example.com/quoted" // the module path may be quoted
+
+go 1.22.3
+
+toolchain go1.22.3
@@ -0,0 +1,9 @@
+module example.com/app
+
+go 1.14
+
+require example.com/fn v0.0.0
+
+replace (
+	example.com/fn => ./fn
+)
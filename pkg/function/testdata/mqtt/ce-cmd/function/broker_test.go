@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/mqtt/fn"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// TestBroker runs the scaffolding of the mqtt protocol against an in-process
+// broker, and sends it an event in binary mode with MQTT 5 user properties,
+// and an event in structured mode, as MQTT 3.1.1 clients do.  It then drops
+// the function's connection, and sends an event once it has reconnected.
+func TestBroker(t *testing.T) {
+	broker := mqtt.New(nil)
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal("AddHook() =", err)
+	}
+	tcp := listeners.NewTCP("tcp", "127.0.0.1:0", nil)
+	if err := broker.AddListener(tcp); err != nil {
+		t.Fatal("AddListener() =", err)
+	}
+	go broker.Serve()
+	defer broker.Close()
+
+	ctx := context.Background()
+	responses := make(chan *paho.Publish, 10)
+	client := connect(t, tcp.Address(), responses)
+	if _, err := client.Subscribe(ctx, &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{
+		{Topic: "responses", QoS: 1},
+		{Topic: "replies/#", QoS: 1},
+	}}); err != nil {
+		t.Fatal("Subscribe() =", err)
+	}
+
+	port := freePort(t)
+	os.Setenv("PORT", strconv.Itoa(port))
+	os.Setenv("CE_MQTT_BROKER", "mqtt://"+tcp.Address())
+	os.Setenv("CE_MQTT_TOPICS", "devices/+/events")
+	os.Setenv("CE_MQTT_CLIENT_ID", "fn")
+	os.Setenv("CE_MQTT_RESPONSE_TOPIC", "responses")
+	go main()
+	// The function serves /version once it has subscribed.
+	if err := waitForReady(fmt.Sprintf("http://127.0.0.1:%d/version", port)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*paho.Publish{{
+		Topic:   "devices/a/events",
+		QoS:     1,
+		Payload: []byte(`{"temperature":21}`),
+		Properties: &paho.PublishProperties{
+			ContentType:     "application/json",
+			ResponseTopic:   "replies/a",
+			CorrelationData: []byte("a"),
+			User: paho.UserProperties{
+				{Key: "specversion", Value: "1.0"},
+				{Key: "id", Value: "1"},
+				{Key: "source", Value: "devices/a"},
+				{Key: "type", Value: "reading"},
+				{Key: "unit", Value: "celsius"},
+				// Not a CloudEvents attribute, so it is ignored.
+				{Key: "trace-id", Value: "abc"},
+			},
+		},
+	}, {
+		Topic:   "devices/b/events",
+		QoS:     1,
+		Payload: []byte(`{"specversion":"1.0","id":"2","source":"devices/b","type":"reading"}`),
+	}} {
+		if _, err := client.Publish(ctx, p); err != nil {
+			t.Fatal("Publish() =", err)
+		}
+	}
+
+	got := make(map[string]*paho.Publish)
+	timeout := time.After(30 * time.Second)
+	for len(got) < 2 {
+		select {
+		case p := <-responses:
+			got[p.Topic] = p
+		case <-timeout:
+			t.Fatalf("got responses on %v, wanted responses on replies/a and responses", got)
+		}
+	}
+
+	// The response to the binary event is sent to its response topic, and
+	// the other to CE_MQTT_RESPONSE_TOPIC.
+	if p := got["replies/a"]; p == nil {
+		t.Error("no response on replies/a")
+	} else if id, corr := p.Properties.User.Get("id"), string(p.Properties.CorrelationData); id != "1-response" || corr != "a" {
+		t.Errorf("response on replies/a has id %q and correlation data %q, wanted 1-response and a", id, corr)
+	}
+	if p := got["responses"]; p == nil {
+		t.Error("no response on responses")
+	} else if id := p.Properties.User.Get("id"); id != "2-response" {
+		t.Errorf("response on responses has id %q, wanted 2-response", id)
+	}
+
+	// The events may be handled in any order.
+	events := fn.Received()
+	if len(events) != 2 {
+		t.Fatalf("Received() = %v, wanted 2 events", events)
+	}
+	if events[0].ID() != "1" {
+		events[0], events[1] = events[1], events[0]
+	}
+	binary := events[0]
+	if binary.ID() != "1" || binary.Source() != "devices/a" || binary.Type() != "reading" ||
+		binary.DataContentType() != "application/json" || string(binary.Data()) != `{"temperature":21}` ||
+		binary.Extensions()["unit"] != "celsius" {
+		t.Errorf("binary event = %v", binary)
+	}
+	if structured := events[1]; structured.ID() != "2" || structured.Source() != "devices/b" {
+		t.Errorf("structured event = %v", structured)
+	}
+
+	// The function reconnects when the broker drops its connection.
+	cl, ok := broker.Clients.Get("fn")
+	if !ok {
+		t.Fatal("the function is not connected")
+	}
+	// DisconnectClient returns the reason code as its error.
+	if err := broker.DisconnectClient(cl, packets.ErrAdministrativeAction); !errors.Is(err, packets.ErrAdministrativeAction) {
+		t.Fatal("DisconnectClient() =", err)
+	}
+	for i := 0; ; i++ {
+		if c, ok := broker.Clients.Get("fn"); ok && c != cl && !c.Closed() && c.State.Subscriptions.Len() > 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the function did not reconnect")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if _, err := client.Publish(ctx, &paho.Publish{
+		Topic:   "devices/c/events",
+		QoS:     1,
+		Payload: []byte(`{"specversion":"1.0","id":"3","source":"devices/c","type":"reading"}`),
+	}); err != nil {
+		t.Fatal("Publish() =", err)
+	}
+	select {
+	case p := <-responses:
+		if id := p.Properties.User.Get("id"); p.Topic != "responses" || id != "3-response" {
+			t.Errorf("got a response on %s with id %q, wanted one on responses with id 3-response", p.Topic, id)
+		}
+	case <-timeout:
+		t.Fatal("no response after reconnecting")
+	}
+}
+
+// connect connects a client to the broker, which passes the messages that it
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		broker string
+		want   string
+	}{{
+		name:   "mqtt",
+		broker: "mqtt://broker.example.com",
+		want:   "broker.example.com:1883",
+	}, {
+		name:   "mqtts",
+		broker: "mqtts://broker.example.com",
+		want:   "broker.example.com:8883",
+	}, {
+		name:   "port",
+		broker: "mqtts://broker.example.com:8884",
+		want:   "broker.example.com:8884",
+	}, {
+		name:   "ipv6",
+		broker: "tcp://[::1]",
+		want:   "[::1]:1883",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, err := url.Parse(test.broker)
+			if err != nil {
+				t.Fatal("Parse() =", err)
+			}
+			useTLS, err := secure(broker)
+			if err != nil {
+				t.Fatal("secure() =", err)
+			}
+			if got := address(broker, useTLS); got != test.want {
+				t.Errorf("address() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+// receives to the channel.
+func connect(t *testing.T, addr string, received chan<- *paho.Publish) *paho.Client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("Dial() =", err)
+	}
+	client := paho.NewClient(paho.ClientConfig{
+		Conn: conn,
+		OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+			func(pr paho.PublishReceived) (bool, error) {
+				received <- pr.Packet
+				return true, nil
+			},
+		},
+	})
+	if _, err := client.Connect(context.Background(), &paho.Connect{ClientID: "test", CleanStart: true, KeepAlive: 30}); err != nil {
+		t.Fatal("Connect() =", err)
+	}
+	t.Cleanup(func() { client.Disconnect(&paho.Disconnect{}) })
+	return client
+}
+
+// freePort returns a port that is free to listen on.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// waitForReady waits for the function to serve url.
+func waitForReady(url string) error {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get(url); err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the function is not serving: %v", err)
+}
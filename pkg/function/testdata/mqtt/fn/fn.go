@@ -0,0 +1,32 @@
+package fn
+
+import (
+	"context"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+var (
+	mu       sync.Mutex
+	received []cloudevents.Event
+)
+
+// Handle records the events that it receives, and responds to them.
+func Handle(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	received = append(received, event)
+	resp := cloudevents.NewEvent()
+	resp.SetID(event.ID() + "-response")
+	resp.SetSource("example.com/mqtt/fn")
+	resp.SetType("response")
+	return &resp, nil
+}
+
+// Received returns the events received so far.
+func Received() []cloudevents.Event {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]cloudevents.Event(nil), received...)
+}
@@ -0,0 +1,23 @@
+module example.com/mqtt
+
+go 1.21
+
+require (
+	github.com/cloudevents/sdk-go/v2 v2.3.1
+	github.com/eclipse/paho.golang v0.21.0
+	github.com/mochi-mqtt/server/v2 v2.4.6
+)
+
+require (
+	github.com/google/uuid v1.1.1 // indirect
+	github.com/gorilla/websocket v1.5.1 // indirect
+	github.com/hashicorp/golang-lru v0.5.3 // indirect
+	github.com/lightstep/tracecontext.go v0.0.0-20181129014701-1757c391b1ac // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	go.opencensus.io v0.22.0 // indirect
+	go.uber.org/atomic v1.4.0 // indirect
+	go.uber.org/multierr v1.1.0 // indirect
+	go.uber.org/zap v1.10.0 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,23 @@
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Receiver is not preferred over the other candidates.
+func Receiver(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+func Handle(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+func OnOrderCreated(event cloudevents.Event) {
+}
+
+// unexported functions are never candidates.
+func helper(event cloudevents.Event) {
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/nats/fn"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// TestCore runs the scaffolding of the nats protocol against an embedded
+// server, and sends it a request.
+func TestCore(t *testing.T) {
+	s, conn := runServer(t)
+	os.Setenv("CE_NATS_SUBJECT", "events.>")
+	os.Setenv("CE_NATS_QUEUE", "fn")
+	subs := s.NumSubscriptions()
+	go main()
+
+	// Requests fail until the function has subscribed.
+	for i := 0; s.NumSubscriptions() == subs; i++ {
+		if i == 100 {
+			t.Fatal("the function did not subscribe")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	event := `{"specversion":"1.0","id":"1","source":"test","type":"test"}`
+	resp, err := conn.Request("events.test", []byte(event), 10*time.Second)
+	if err != nil {
+		t.Fatal("Request() =", err)
+	}
+	var got struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s) = %v", resp.Data, err)
+	}
+	if got.ID != "1-response" {
+		t.Errorf("response id = %q, wanted %q", got.ID, "1-response")
+	}
+}
+
+// TestJetStream runs the scaffolding of the nats protocol against an
+// embedded server with JetStream, whose stream holds an event that the
+// function fails twice, another event, and a message that isn't an event.
+func TestJetStream(t *testing.T) {
+	_, conn := runServer(t)
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatal("JetStream() =", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}}); err != nil {
+		t.Fatal("AddStream() =", err)
+	}
+	for _, data := range []string{
+		`{"specversion":"1.0","id":"1","source":"test","type":"test","subject":"flaky"}`,
+		`{"specversion":"1.0","id":"2","source":"test","type":"test"}`,
+		`not an event`,
+	} {
+		if _, err := js.Publish("events.test", []byte(data)); err != nil {
+			t.Fatal("Publish() =", err)
+		}
+	}
+
+	// The function acknowledges the messages on their reply subjects,
+	// $JS.ACK.<stream>.<consumer>.<deliveries>.<stream sequence>...
+	acks, err := conn.SubscribeSync("$JS.ACK.EVENTS.fn.>")
+	if err != nil {
+		t.Fatal("SubscribeSync() =", err)
+	}
+	os.Setenv("CE_NATS_SUBJECT", "events.>")
+	os.Setenv("CE_NATS_JETSTREAM_DURABLE", "fn")
+	go main()
+
+	// The flaky event is redelivered until the function succeeds, and all
+	// the messages are acknowledged or terminated.
+	got := make(map[string][]string)
+	for i := 0; i < 5; i++ {
+		msg, err := acks.NextMsg(30 * time.Second)
+		if err != nil {
+			t.Fatalf("NextMsg() = %v, after acknowledgements %v", err, got)
+		}
+		seq := strings.Split(msg.Subject, ".")[5]
+		got[seq] = append(got[seq], string(msg.Data))
+	}
+	if want := map[string][]string{
+		"1": {"-NAK", "-NAK", "+ACK"},
+		"2": {"+ACK"},
+		"3": {"+TERM"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("acknowledgements = %v, wanted %v", got, want)
+	}
+	received := fn.Received()
+	sort.Strings(received)
+	if want := []string{"1", "1", "1", "2"}; !reflect.DeepEqual(received, want) {
+		t.Errorf("Received() = %v, wanted %v (in any order)", received, want)
+	}
+}
+
+// runServer runs an embedded server with JetStream, points the function at
+// it, and returns the server and a connection to it.
+func runServer(t *testing.T) (*server.Server, *nats.Conn) {
+	s, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal("NewServer() =", err)
+	}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("the server is not ready for connections")
+	}
+	os.Setenv("CE_NATS_URL", s.ClientURL())
+
+	conn, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal("Connect() =", err)
+	}
+	t.Cleanup(conn.Close)
+	return s, conn
+}
@@ -0,0 +1,10 @@
+module example.com/nats
+
+go 1.16
+
+require (
+	github.com/cloudevents/sdk-go/protocol/nats/v2 v2.3.1
+	github.com/cloudevents/sdk-go/v2 v2.3.1
+	github.com/nats-io/nats-server/v2 v2.3.0
+	github.com/nats-io/nats.go v1.11.0
+)
@@ -0,0 +1,23 @@
+package nearmiss
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type Order struct {
+	ID string `json:"id"`
+}
+
+func Receiver(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, bool) {
+	return nil, true
+}
+
+func Orders(ctx context.Context, order *Order) error {
+	return nil
+}
+
+func Helper(name string, count int, verbose bool) (string, int, error) {
+	return name, count, nil
+}
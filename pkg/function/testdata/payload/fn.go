@@ -0,0 +1,32 @@
+package foo
+
+import (
+	"context"
+)
+
+type Order struct {
+	ID string `json:"id"`
+}
+
+type Confirmation struct {
+	ID string `json:"id"`
+}
+
+func Handle(ctx context.Context, order Order) (*Confirmation, error) {
+	return &Confirmation{ID: order.ID}, nil
+}
+
+func Sink(ctx context.Context, order Order) error {
+	return nil
+}
+
+// The payload must be a struct value.
+func Pointer(ctx context.Context, order *Order) error {
+	return nil
+}
+
+type Name string
+
+func NotStruct(ctx context.Context, name Name) error {
+	return nil
+}
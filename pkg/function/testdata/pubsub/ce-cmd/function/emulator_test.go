@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"example.com/pubsub/fn"
+)
+
+const project = "test"
+
+// TestEmulator runs the scaffolding of the pubsub protocol against an
+// in-memory fake of Pub/Sub, which creates the topic and the subscription, and
+// sends it a binary event that the function fails twice, a structured event,
+// a binary event that the function NACKs once, and a message that isn't an
+// event.
+func TestEmulator(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	os.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, project)
+	if err != nil {
+		t.Fatal("NewClient() =", err)
+	}
+	defer client.Close()
+	replies, err := client.CreateTopic(ctx, "replies")
+	if err != nil {
+		t.Fatal("CreateTopic() =", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "replies", pubsub.SubscriptionConfig{Topic: replies})
+	if err != nil {
+		t.Fatal("CreateSubscription() =", err)
+	}
+
+	port := freePort(t)
+	os.Setenv("PORT", strconv.Itoa(port))
+	os.Setenv("CE_PUBSUB_PROJECT", project)
+	os.Setenv("CE_PUBSUB_SUBSCRIPTION", "fn")
+	os.Setenv("CE_PUBSUB_TOPIC", "events")
+	os.Setenv("CE_PUBSUB_AUTO_CREATE", "true")
+	os.Setenv("CE_PUBSUB_ACK_DEADLINE", "20s")
+	os.Setenv("CE_PUBSUB_MAX_OUTSTANDING", "1")
+	os.Setenv("CE_PUBSUB_REPLY_TOPIC", "replies")
+	go main()
+	// The function serves /version once it has created the subscription.
+	if err := waitForReady(fmt.Sprintf("http://127.0.0.1:%d/version", port)); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := client.Subscription("fn").Config(ctx)
+	if err != nil {
+		t.Fatal("Config() =", err)
+	}
+	if config.Topic.ID() != "events" || config.AckDeadline != 20*time.Second {
+		t.Errorf("subscription has topic %s and ack deadline %v, wanted events and 20s", config.Topic.ID(), config.AckDeadline)
+	}
+
+	topic := client.Topic("events")
+	defer topic.Stop()
+	var published []string
+	for _, m := range []*pubsub.Message{{
+		Data: []byte(`data`),
+		Attributes: map[string]string{
+			"ce-specversion": "1.0",
+			"ce-id":          "1",
+			"ce-source":      "test",
+			"ce-type":        "test",
+			"ce-subject":     "flaky",
+		},
+	}, {
+		Data:       []byte(`{"specversion":"1.0","id":"2","source":"test","type":"test"}`),
+		Attributes: map[string]string{"Content-Type": "application/cloudevents+json"},
+	}, {
+		Data: []byte(`data`),
+		Attributes: map[string]string{
+			"ce-specversion": "1.0",
+			"ce-id":          "3",
+			"ce-source":      "test",
+			"ce-type":        "test",
+			"ce-subject":     "nacked",
+		},
+	}, {
+		Data: []byte(`not an event`),
+	}} {
+		id, err := topic.Publish(ctx, m).Get(ctx)
+		if err != nil {
+			t.Fatal("Publish() =", err)
+		}
+		published = append(published, id)
+	}
+
+	// The flaky and NACKed events are nacked and redelivered until the
+	// function succeeds, and all the messages are acked.
+	want := []string{"1", "1", "1", "2", "3", "3"}
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		got := fn.Received()
+		sort.Strings(got)
+		if reflect.DeepEqual(got, want) && acked(srv, published) == 4 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	got := fn.Received()
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Received() = %v, wanted %v (in any order)", got, want)
+	}
+	if n := acked(srv, published); n != 4 {
+		t.Errorf("acked %d messages, wanted 4", n)
+	}
+
+	// The responses are published to CE_PUBSUB_REPLY_TOPIC.
+	ids := make(chan string, 10)
+	rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	go sub.Receive(rctx, func(ctx context.Context, m *pubsub.Message) {
+		m.Ack()
+		ids <- m.Attributes["ce-id"]
+	})
+	responses := map[string]bool{}
+	for len(responses) < 3 {
+		select {
+		case id := <-ids:
+			responses[id] = true
+		case <-rctx.Done():
+			t.Fatalf("got responses %v, wanted 1-response, 2-response and 3-response", responses)
+		}
+	}
+	if !responses["1-response"] || !responses["2-response"] || !responses["3-response"] {
+		t.Errorf("got responses %v, wanted 1-response, 2-response and 3-response", responses)
+	}
+}
+
+// acked returns the number of the messages with the IDs that were acked.
+func acked(srv *pstest.Server, ids []string) int {
+	n := 0
+	for _, id := range ids {
+		if m := srv.Message(id); m != nil && m.Acks > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// freePort returns a port that is free to listen on.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// waitForReady waits for the function to serve url.
+func waitForReady(url string) error {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get(url); err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the function is not serving: %v", err)
+}
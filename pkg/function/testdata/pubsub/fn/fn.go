@@ -0,0 +1,46 @@
+package fn
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+var (
+	mu       sync.Mutex
+	received []string
+	failures int
+	nacks    int
+)
+
+// Handle records the events that it receives, fails the first two deliveries
+// of events with the subject "flaky", NACKs the first delivery of events with
+// the subject "nacked", and responds to the others.
+func Handle(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	received = append(received, event.ID())
+	if event.Subject() == "flaky" && failures < 2 {
+		failures++
+		return nil, errors.New("flaky")
+	}
+	if event.Subject() == "nacked" && nacks < 1 {
+		nacks++
+		return nil, protocol.NewReceipt(false, "not yet")
+	}
+	resp := cloudevents.NewEvent()
+	resp.SetID(event.ID() + "-response")
+	resp.SetSource("example.com/pubsub/fn")
+	resp.SetType("response")
+	return &resp, nil
+}
+
+// Received returns the IDs of the events received so far.
+func Received() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), received...)
+}
@@ -0,0 +1,10 @@
+module example.com/pubsub
+
+go 1.14
+
+require (
+	cloud.google.com/go/pubsub v1.3.1
+	github.com/cloudevents/sdk-go/protocol/pubsub/v2 v2.4.1
+	github.com/cloudevents/sdk-go/v2 v2.4.1
+	google.golang.org/grpc v1.29.1
+)
@@ -0,0 +1,19 @@
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+//cloudevents:function path=/events types=com.example.order.*
+func OnOrder(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+//cloudevents:function types=com.example.refund source=/billing
+func OnRefund(event cloudevents.Event) {
+}
+
+func OnOther(event cloudevents.Event) {
+}
@@ -0,0 +1,18 @@
+//go:build kafka
+// +build kafka
+
+package foo
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Receive is only compiled into the kafka build, which its directive
+// selects.
+//
+//cloudevents:function protocol=kafka types=com.example.order
+func Receive(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package alias
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// Receiver takes the event type from the event package and returns an alias
+// of protocol.Result.
+func Receiver(ctx context.Context, e event.Event) cloudevents.Result {
+	return nil
+}
@@ -0,0 +1,9 @@
+package broken
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receiver(e cloudevents.Event) error {
+	return undefined
+}
@@ -0,0 +1,13 @@
+package convertible
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Response converts from cloudevents.Event, but a *Response isn't assignable
+// to a *cloudevents.Event.
+type Response cloudevents.Event
+
+func Receiver(e cloudevents.Event) (*Response, error) {
+	return nil, nil
+}
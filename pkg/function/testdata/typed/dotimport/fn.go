@@ -0,0 +1,9 @@
+package dotimport
+
+import (
+	. "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receiver(e Event) (*Event, error) {
+	return nil, nil
+}
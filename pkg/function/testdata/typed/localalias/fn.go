@@ -0,0 +1,11 @@
+package localalias
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type Event = cloudevents.Event
+
+func Receiver(e Event) error {
+	return nil
+}
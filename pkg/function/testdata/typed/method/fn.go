@@ -0,0 +1,49 @@
+package method
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type Handler struct {
+	greeting string
+}
+
+func NewHandler(ctx context.Context) (*Handler, error) {
+	return &Handler{greeting: "hello"}, nil
+}
+
+func (h *Handler) Receive(ctx context.Context, event cloudevents.Event) error {
+	return nil
+}
+
+// Orphan has no constructor, so its method cannot be used.
+type Orphan struct{}
+
+func (o Orphan) Receive(event cloudevents.Event) {
+}
+
+// Value's constructor returns a value, on which Receive cannot be called.
+type Value struct{}
+
+func NewValue(ctx context.Context) (Value, error) {
+	return Value{}, nil
+}
+
+func (v *Value) Receive(event cloudevents.Event) {
+}
+
+// Narrow's constructor takes more than a context.Context, so the scaffolding
+// can't construct it.
+type Narrow struct{}
+
+func NewNarrow(ctx interface {
+	context.Context
+	Name() string
+}) (*Narrow, error) {
+	return &Narrow{}, nil
+}
+
+func (n *Narrow) Receive(event cloudevents.Event) {
+}
@@ -0,0 +1,14 @@
+package named
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+type Handler func(context.Context, cloudevents.Event) protocol.Result
+
+var Receiver Handler = func(ctx context.Context, e cloudevents.Event) protocol.Result {
+	return nil
+}
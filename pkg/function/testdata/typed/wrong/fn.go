@@ -0,0 +1,9 @@
+package wrong
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func Receiver(e cloudevents.Event) bool {
+	return true
+}
@@ -0,0 +1,337 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vaikas/gofunctypechecker/pkg/detect"
+)
+
+// listedPackage holds the subset of the `go list -json` output that we need
+// to type-check a package against the export data of its dependencies.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Export     string
+	GoFiles    []string
+	ImportMap  map[string]string
+	DepOnly    bool
+	Error      *struct {
+		Err string
+	}
+}
+
+// typedPackage is a type-checked Go package, along with the importer that
+// was used to load its dependencies.
+type typedPackage struct {
+	Fset     *token.FileSet
+	Types    *types.Package
+	Importer types.Importer
+}
+
+// loadPackage type-checks the Go package in dir, as built with the given
+// build tags.  It uses the go command to locate the package's files and to
+// compile the export data of its dependencies, as well as of the packages in
+// extra, which the importer is then able to load.
+func loadPackage(dir string, tags []string, extra ...string) (*typedPackage, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, exports, err := listPackages(abs, tags, append([]string{"."}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	var target *listedPackage
+	for _, lp := range listed {
+		if !lp.DepOnly && lp.Dir == abs {
+			target = lp
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("unable to find a Go package in %q", dir)
+	}
+	if len(target.GoFiles) == 0 && target.Error != nil {
+		return nil, errors.New(target.Error.Err)
+	}
+
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, len(target.GoFiles))
+	for _, name := range target.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(target.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	imp := newImporter(fset, exports, target.ImportMap)
+	pkg, typeErrs := checkPackage(target.ImportPath, fset, files, imp)
+	if len(typeErrs) > 0 {
+		msgs := make([]string, 0, len(typeErrs))
+		for _, err := range typeErrs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, errors.New(strings.Join(msgs, "\n"))
+	}
+
+	return &typedPackage{
+		Fset:     fset,
+		Types:    pkg,
+		Importer: imp,
+	}, nil
+}
+
+// listPackages uses the go command in dir to list the packages matching
+// patterns and their dependencies, as built with the given build tags, and to
+// compile their export data.  It returns the listed packages, along with the
+// paths of the export data files keyed by import path.
+func listPackages(dir string, tags []string, patterns ...string) ([]*listedPackage, map[string]string, error) {
+	args := []string{"list", "-e", "-export", "-deps", "-json", "-tags=" + strings.Join(tags, ",")}
+	cmd := exec.Command("go", append(args, patterns...)...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("go list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var listed []*listedPackage
+	exports := make(map[string]string)
+	for dec := json.NewDecoder(&stdout); ; {
+		lp := &listedPackage{}
+		if err := dec.Decode(lp); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if lp.Export != "" {
+			exports[lp.ImportPath] = lp.Export
+		}
+		listed = append(listed, lp)
+	}
+	return listed, exports, nil
+}
+
+// newImporter returns an importer that loads packages from the export data
+// files in exports, after mapping their import paths through importMap.
+func newImporter(fset *token.FileSet, exports, importMap map[string]string) types.Importer {
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if mapped, ok := importMap[path]; ok {
+			path = mapped
+		}
+		export, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(export)
+	})
+}
+
+// checkPackage type-checks the files of the package with the given import
+// path, and returns the type errors it finds.
+func checkPackage(path string, fset *token.FileSet, files []*ast.File, imp types.Importer) (*types.Package, []error) {
+	var typeErrs []error
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			typeErrs = append(typeErrs, err)
+		},
+	}
+	pkg, _ := conf.Check(path, fset, files, nil)
+	return pkg, typeErrs
+}
+
+// findTypedCandidates type-checks the package in dir and returns its
+// exported, package-level functions (including variables of function type)
+// and the exported methods of its exported types, sorted by name.  Those that
+// can be called where one of sigs is expected have their Signature set.
+// The others carry an error explaining why they don't match.
+func findTypedCandidates(dir string, tags []string, sigs []signature) ([]candidate, error) {
+	tp, err := loadPackage(dir, tags, signaturePackages(sigs)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	scope := tp.Types.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Func, *types.Var:
+			if sig, ok := obj.Type().Underlying().(*types.Signature); ok {
+				candidates = append(candidates, tp.match(obj, name, sig, sigs))
+			}
+
+		case *types.TypeName:
+			named, ok := obj.Type().(*types.Named)
+			if !ok || obj.IsAlias() {
+				continue
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				m := named.Method(i)
+				if !m.Exported() {
+					continue
+				}
+				c := tp.match(m, name+"."+m.Name(), m.Type().(*types.Signature), sigs)
+				c.Constructor = constructorName(name)
+				if c.Err == nil {
+					ctor, ok := scope.Lookup(c.Constructor).(*types.Func)
+					if !ok || !isTypedConstructor(tp.Importer, ctor, named, m) {
+						c.Signature, c.Err = "", constructorError(c.Name, name)
+					}
+				}
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates, nil
+}
+
+// match checks the signature sig of the object obj against sigs, and returns
+// the candidate it describes under the given name.
+func (tp *typedPackage) match(obj types.Object, name string, sig *types.Signature, sigs []signature) candidate {
+	c := candidate{Name: name}
+	for i, want := range sigs {
+		if b, ok := matchTypedSignature(tp.Importer, tp.Types, sig, want.FunctionSignature); ok {
+			c.matched(&sigs[i], b)
+			return c
+		}
+	}
+	c.Err = diagnose(name, tp.Fset.Position(obj.Pos()).String(), types.TypeString(sig, packageName(tp.Types)),
+		tp.typedArgs(sig.Params(), false), tp.typedArgs(sig.Results(), true), sigs)
+	return c
+}
+
+// typedArgs describes the variables in tuple, which are the results of a
+// function when result is set, or its parameters otherwise, for diagnostics.
+func (tp *typedPackage) typedArgs(tuple *types.Tuple, result bool) []actualArg {
+	args := make([]actualArg, 0, tuple.Len())
+	for i := 0; i < tuple.Len(); i++ {
+		t := tuple.At(i).Type()
+		args = append(args, actualArg{
+			Text: types.TypeString(t, packageName(tp.Types)),
+			Matches: func(want detect.FunctionArg, exact bool) bool {
+				var b binding
+				return matchTypedArg(tp.Importer, tp.Types, &b, t, want, result, exact)
+			},
+		})
+	}
+	return args
+}
+
+// packageName returns a types.Qualifier that qualifies names by package
+// name, as they would typically be written in source, except for names in
+// the package pkg itself.
+func packageName(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+// signaturePackages returns the import paths referenced by sigs.
+func signaturePackages(sigs []signature) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, sig := range sigs {
+		for _, arg := range append(append([]detect.FunctionArg{}, sig.In...), sig.Out...) {
+			if arg.ImportPath != "" && !seen[arg.ImportPath] {
+				seen[arg.ImportPath] = true
+				paths = append(paths, arg.ImportPath)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// matchTypedSignature checks whether a function with signature got can be
+// used where want is expected: the expected parameters must be assignable to
+// the function's parameters, and the function's results must be assignable
+// to the expected results, as the adapters call it directly.  Functions
+// with user types (from the package pkg) are called by generated code, so
+// the types must match exactly.  The user types are returned in a binding.
+func matchTypedSignature(imp types.Importer, pkg *types.Package, got *types.Signature, want detect.FunctionSignature) (binding, bool) {
+	var b binding
+	if got.Variadic() || got.Params().Len() != len(want.In) || got.Results().Len() != len(want.Out) {
+		return b, false
+	}
+	exact := hasPlaceholders(want)
+	for i, arg := range want.In {
+		if !matchTypedArg(imp, pkg, &b, got.Params().At(i).Type(), arg, false, exact) {
+			return b, false
+		}
+	}
+	for i, arg := range want.Out {
+		if !matchTypedArg(imp, pkg, &b, got.Results().At(i).Type(), arg, true, exact) {
+			return b, false
+		}
+	}
+	return b, true
+}
+
+// matchTypedArg checks whether the type t of a parameter (or a result, when
+// result is set) can be used where arg is expected, binding user types to b.
+// The adapters pass arguments and return results as they are, so the types
+// must be assignable, or identical when exact is set.
+func matchTypedArg(imp types.Importer, pkg *types.Package, b *binding, t types.Type, arg detect.FunctionArg, result, exact bool) bool {
+	if isPlaceholder(arg) {
+		return b.bindType(pkg, t, arg)
+	}
+	wt, err := resolveArg(imp, arg)
+	switch {
+	case err != nil:
+		return false
+	case exact:
+		return types.Identical(t, wt)
+	case result:
+		return types.AssignableTo(t, wt)
+	default:
+		return types.AssignableTo(wt, t)
+	}
+}
+
+// resolveArg returns the type described by arg.
+func resolveArg(imp types.Importer, arg detect.FunctionArg) (types.Type, error) {
+	var obj types.Object
+	if arg.ImportPath == "" {
+		obj = types.Universe.Lookup(arg.Name)
+	} else {
+		pkg, err := imp.Import(arg.ImportPath)
+		if err != nil {
+			return nil, err
+		}
+		obj = pkg.Scope().Lookup(arg.Name)
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a type", arg.String())
+	}
+	if arg.Pointer {
+		return types.NewPointer(tn.Type()), nil
+	}
+	return tn.Type(), nil
+}
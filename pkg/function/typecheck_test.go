@@ -0,0 +1,155 @@
+package function
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit"
+)
+
+func TestDetectTypes(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the types detection mode requires the go command")
+	}
+
+	// This module depends on the CloudEvents SDK, so that its packages
+	// type-check.
+	const wd = "./testdata/typed"
+
+	tests := []struct {
+		name    string
+		pkg     string
+		fn      string
+		match   bool
+		want    string
+		wantErr string
+	}{{
+		name:  "aliased result",
+		pkg:   "./alias",
+		match: true,
+	}, {
+		name:  "dot import",
+		pkg:   "./dotimport",
+		match: true,
+	}, {
+		name:  "local type alias",
+		pkg:   "./localalias",
+		match: true,
+	}, {
+		name:  "named function type",
+		pkg:   "./named",
+		fn:    "Receiver",
+		match: true,
+	}, {
+		name:  "method receiver",
+		pkg:   "./method",
+		match: true,
+		want:  "Handler.Receive",
+	}, {
+		name:    "method receiver (no constructor)",
+		pkg:     "./method",
+		fn:      "Orphan.Receive",
+		wantErr: "requires a constructor: func NewOrphan(context.Context) (*Orphan, error)",
+	}, {
+		name:    "method receiver (value constructor)",
+		pkg:     "./method",
+		fn:      "Value.Receive",
+		wantErr: "requires a constructor",
+	}, {
+		name:    "method receiver (narrower context)",
+		pkg:     "./method",
+		fn:      "Narrow.Receive",
+		wantErr: "requires a constructor: func NewNarrow(context.Context) (*Narrow, error)",
+	}, {
+		name:  "typed payload",
+		pkg:   "./payload",
+		fn:    "Handle",
+		match: true,
+		want:  "Handle",
+	}, {
+		name:    "typed payload (pointer)",
+		pkg:     "./payload",
+		fn:      "Pointer",
+		wantErr: "Pointer has signature func(ctx context.Context, order *Order) error",
+	}, {
+		name:    "typed payload (not a struct)",
+		pkg:     "./payload",
+		fn:      "NotStruct",
+		wantErr: "does not match a supported signature",
+	}, {
+		name:    "convertible but not assignable",
+		pkg:     "./convertible",
+		fn:      "Receiver",
+		wantErr: "does not match a supported signature",
+	}, {
+		name:    "wrong signature",
+		pkg:     "./wrong",
+		fn:      "Receiver",
+		wantErr: "fn.go:7:6: Receiver has signature func(e ",
+	}, {
+		name:    "wrong signature (unset)",
+		pkg:     "./wrong",
+		wantErr: "unable to find a function",
+	}, {
+		name:    "type error",
+		pkg:     "./broken",
+		wantErr: "fn.go:8:9: undefined: undefined",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := Detector{
+				Package:  test.pkg,
+				Function: test.fn,
+				Protocol: "http",
+				Mode:     "types",
+			}
+			p, err := d.Detect(packit.DetectContext{
+				WorkingDir: wd,
+				CNBPath:    cnbPath,
+			})
+			if err != nil && test.match {
+				t.Fatal("Unexpected error:", err)
+			} else if err == nil && !test.match {
+				t.Fatal("Unexpected match:", p)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Detect() = %v, wanted error containing %q", err, test.wantErr)
+				}
+				return
+			}
+
+			want := test.want
+			if want == "" {
+				want = "Receiver"
+			}
+			if got := p.Plan.Requires[0].Metadata.(map[string]interface{})["function"]; got != want {
+				t.Errorf("function = %v, wanted %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDetectTypesWithoutGo(t *testing.T) {
+	// The go command is not on PATH during a buildpack's detection, so the
+	// types mode falls back to the syntax mode.
+	t.Setenv("PATH", t.TempDir())
+
+	d := Detector{
+		Package:  "./method",
+		Protocol: "http",
+		Mode:     "types",
+	}
+	p, err := d.Detect(packit.DetectContext{
+		WorkingDir: "./testdata/typed",
+		CNBPath:    cnbPath,
+	})
+	if err != nil {
+		t.Fatal("Detect() =", err)
+	}
+	if got := p.Plan.Requires[0].Metadata.(map[string]interface{})["function"]; got != "Handler.Receive" {
+		t.Errorf("function = %v, wanted %q", got, "Handler.Receive")
+	}
+}
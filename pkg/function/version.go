@@ -0,0 +1,97 @@
+package function
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// buildInfoVar is the variable of the generated main package that the build
+// stamps with the description of the function and its build.
+const buildInfoVar = "main.buildInfo"
+
+// buildInfo returns the description of the function and its build, which is
+// stamped into the binary: the image labels without their prefix, along with
+// the versions of the buildpack and the template data, and the VCS revision of
+// the application, if known.  It is encoded as base64 JSON, as spaces
+// separate the linker flags.
+func (b *Builder) buildInfo(workingDir string, i *TemplateData, labels map[string]string) (string, error) {
+	info := make(map[string]string, len(labels)+4)
+	for k, v := range labels {
+		info[strings.TrimPrefix(k, labelPrefix)] = v
+	}
+	info["buildpack"] = i.Build.Buildpack
+	info["buildpack-version"] = i.Build.BuildpackVersion
+	info["template-data-version"] = strconv.Itoa(i.Version)
+	revision := b.Revision
+	if revision == "" {
+		revision = vcsRevision(workingDir)
+	}
+	if revision != "" {
+		info["revision"] = revision
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ldflags returns the linker flags that stamp the build info into the binary.
+func ldflags(buildInfo string) string {
+	return fmt.Sprintf("-X %s=%s", buildInfoVar, buildInfo)
+}
+
+// setsLdflags returns whether goflags sets -ldflags, which the -ldflags that
+// the Go buildpack passes on the command line replace.
+func setsLdflags(goflags string) bool {
+	for _, flag := range strings.Fields(goflags) {
+		if name := strings.SplitN(strings.TrimPrefix(flag, "-"), "=", 2)[0]; name == "-ldflags" || name == "ldflags" {
+			return true
+		}
+	}
+	return false
+}
+
+// vcsRevision returns the commit that is checked out in the git repository in
+// dir, or "" if there is none.
+func vcsRevision(dir string) string {
+	gitDir := filepath.Join(dir, ".git")
+	head, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	ref := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(ref, "ref: ") {
+		// The HEAD is detached.
+		return commit(ref)
+	}
+	ref = strings.TrimPrefix(ref, "ref: ")
+	if data, err := ioutil.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return commit(strings.TrimSpace(string(data)))
+	}
+	packed, err := ioutil.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return commit(fields[0])
+		}
+	}
+	return ""
+}
+
+// commit returns s if it is the hash of a commit, and "" otherwise.
+func commit(s string) string {
+	if _, err := hex.DecodeString(s); err != nil || len(s) < 40 {
+		return ""
+	}
+	return s
+}
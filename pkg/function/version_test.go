@@ -0,0 +1,138 @@
+package function
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVCSRevision(t *testing.T) {
+	const sha = "f738325a1c0f4d2c9c5e0b6f1f2d9e8a7b6c5d4e"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{{
+		name: "no repository",
+	}, {
+		name: "detached",
+		files: map[string]string{
+			"HEAD": sha + "\n",
+		},
+		want: sha,
+	}, {
+		name: "branch",
+		files: map[string]string{
+			"HEAD":            "ref: refs/heads/main\n",
+			"refs/heads/main": sha + "\n",
+		},
+		want: sha,
+	}, {
+		name: "packed branch",
+		files: map[string]string{
+			"HEAD":        "ref: refs/heads/main\n",
+			"packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" + sha + " refs/heads/main\n",
+		},
+		want: sha,
+	}, {
+		name: "unborn branch",
+		files: map[string]string{
+			"HEAD": "ref: refs/heads/main\n",
+		},
+	}, {
+		name: "malformed",
+		files: map[string]string{
+			"HEAD": "not a commit\n",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				p := filepath.Join(dir, ".git", filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+					t.Fatal("MkdirAll() =", err)
+				}
+				if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal("WriteFile() =", err)
+				}
+			}
+			if got := vcsRevision(dir); got != test.want {
+				t.Errorf("vcsRevision() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	i := &TemplateData{
+		Version: TemplateDataVersion,
+		Build: BuildInfo{
+			Buildpack:        "io.mattmoor.cloudevents.golang.functions",
+			BuildpackVersion: "1.2.3",
+		},
+	}
+	labels := map[string]string{
+		labelPrefix + "name":      "Receiver",
+		labelPrefix + "signature": "func(context.Context, cloudevents.Event) error",
+	}
+	b := &Builder{Revision: "v1.0.0-3-gf738325"}
+
+	got, err := b.buildInfo(t.TempDir(), i, labels)
+	if err != nil {
+		t.Fatal("buildInfo() =", err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(got)
+	if err != nil {
+		t.Fatal("DecodeString() =", err)
+	}
+	var info map[string]string
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal("Unmarshal() =", err)
+	}
+	want := map[string]string{
+		"name":                  "Receiver",
+		"signature":             "func(context.Context, cloudevents.Event) error",
+		"buildpack":             "io.mattmoor.cloudevents.golang.functions",
+		"buildpack-version":     "1.2.3",
+		"template-data-version": "1",
+		"revision":              "v1.0.0-3-gf738325",
+	}
+	if !cmp.Equal(info, want) {
+		t.Error("buildInfo (-want, +got):", cmp.Diff(want, info))
+	}
+}
+
+func TestSetsLdflags(t *testing.T) {
+	tests := []struct {
+		goflags string
+		want    bool
+	}{{
+		goflags: "",
+	}, {
+		goflags: "-mod=mod -tags=custom",
+	}, {
+		goflags: "-ldflags=-s",
+		want:    true,
+	}, {
+		goflags: "-trimpath --ldflags=-w",
+		want:    true,
+	}, {
+		goflags: "-gcflags=-ldflags",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.goflags, func(t *testing.T) {
+			if got := setsLdflags(test.goflags); got != test.want {
+				t.Errorf("setsLdflags(%q) = %t, wanted %t", test.goflags, got, test.want)
+			}
+		})
+	}
+}